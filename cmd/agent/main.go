@@ -1,29 +1,57 @@
 package main
 
 import (
-	"os"
+	"context"
 	"os/signal"
 	"syscall"
 
 	"github.com/VoevodinAnton/metrics/internal/agent/config"
 	"github.com/VoevodinAnton/metrics/internal/agent/core/collector"
 	"github.com/VoevodinAnton/metrics/internal/agent/core/uploader"
+	"github.com/VoevodinAnton/metrics/pkg/encryption"
 	logger "github.com/VoevodinAnton/metrics/pkg/logging"
+	"go.uber.org/zap"
 )
 
 func main() {
-	cfg := config.InitConfig()
+	cfg, err := config.InitConfig()
+	if err != nil {
+		panic(err)
+	}
 
 	logger.NewLogger(cfg.Logger)
 	defer logger.Close()
 
-	c := collector.NewCollector(cfg)
-	u := uploader.NewUploader(cfg, c)
+	c, err := collector.NewCollector(cfg)
+	if err != nil {
+		zap.L().Fatal("collector.NewCollector", zap.Error(err))
+	}
+	var opts []uploader.Option
+	if cfg.CryptoKey != "" {
+		key, err := encryption.LoadPublicKey(cfg.CryptoKey)
+		if err != nil {
+			zap.L().Fatal("encryption.LoadPublicKey", zap.Error(err))
+		}
+		opts = append(opts, uploader.WithPublicKey(key))
+	}
+	u := uploader.NewUploader(cfg, c, opts...)
+	defer func() {
+		if err := u.Close(); err != nil {
+			zap.L().Error("uploader.Close", zap.Error(err))
+		}
+	}()
 
-	listenSignals := make(chan os.Signal, 1)
-	signal.Notify(listenSignals, syscall.SIGINT, syscall.SIGTERM)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	go c.Run()
-	go u.Run()
-	<-listenSignals
+	collectorDone := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(collectorDone)
+	}()
+
+	// The uploader sends the last gauges and counters once ctx is done.
+	u.Run(ctx)
+	<-collectorDone
+	zap.L().Warn("agent stopped")
 }
@@ -2,20 +2,27 @@ package main
 
 import (
 	"context"
-	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
+	grpcapi "github.com/VoevodinAnton/metrics/internal/server/adapters/api/grpc"
 	api "github.com/VoevodinAnton/metrics/internal/server/adapters/api/rest"
+	statsdapi "github.com/VoevodinAnton/metrics/internal/server/adapters/api/statsd"
 	"github.com/VoevodinAnton/metrics/internal/server/adapters/backup"
 	"github.com/VoevodinAnton/metrics/internal/server/adapters/middlewares"
+	"github.com/VoevodinAnton/metrics/internal/server/adapters/retention"
 	"github.com/VoevodinAnton/metrics/internal/server/adapters/store"
 	"github.com/VoevodinAnton/metrics/internal/server/config"
 	"github.com/VoevodinAnton/metrics/internal/server/core/service"
+	"github.com/VoevodinAnton/metrics/pkg/encryption"
 	logger "github.com/VoevodinAnton/metrics/pkg/logging"
 	"go.uber.org/zap"
 )
 
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	cfg, err := config.InitConfig()
 	if err != nil {
@@ -23,51 +30,133 @@ func main() {
 	}
 	logger.NewLogger(cfg.Logger)
 	defer logger.Close()
-	mw := middlewares.NewMiddlewareManager()
-	ctx := context.Background()
+	var mwOpts []middlewares.Option
+	if cfg.CryptoKey != "" {
+		key, err := encryption.LoadPrivateKey(cfg.CryptoKey)
+		if err != nil {
+			zap.L().Fatal("encryption.LoadPrivateKey", zap.Error(err))
+		}
+		mwOpts = append(mwOpts, middlewares.WithPrivateKey(key))
+	}
+	mw := middlewares.NewMiddlewareManager(cfg, mwOpts...)
 	storage, err := store.NewStore(cfg)
 	if err != nil {
 		zap.L().Fatal("store.NewStore", zap.Error(err))
 	}
-	defer storage.Close()
 
 	backup := backup.New(cfg, storage)
+	if cfg.FilePath != "" && !backup.Enabled() {
+		zap.L().Warn("the store keeps the metrics itself, the file backup is disabled",
+			zap.String("path", cfg.FilePath))
+	}
 	if cfg.Restore {
-		err := backup.RestoreMetricsFromFile(ctx)
+		err := backup.RestoreMetricsFromFile(context.Background())
 		if err != nil {
 			zap.L().Error("empty start", zap.Error(err))
 		}
 	}
-	if cfg.FilePath != "" {
+
+	var serviceOpts []service.Option
+	if backup.Enabled() && backup.Synchronous() {
+		if err := backup.OpenWAL(context.Background()); err != nil {
+			zap.L().Fatal("backup.OpenWAL", zap.Error(err))
+		}
+		serviceOpts = append(serviceOpts, service.WithWAL(backup))
+	}
+	if cfg.Buffer.Size > 0 {
+		serviceOpts = append(serviceOpts, service.WithBuffer(cfg.Buffer.Size, cfg.Buffer.FlushInterval))
+	}
+
+	// jobsCtx stops the background jobs once the listeners are shut down.
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	var jobs sync.WaitGroup
+	if backup.Enabled() {
+		jobs.Add(1)
 		go func() {
-			backup.Run(ctx)
+			defer jobs.Done()
+			backup.Run(jobsCtx)
 		}()
-		defer func() {
-			err := backup.SaveMetricsToFile(ctx)
-			if err != nil {
-				zap.L().Error("backup.SaveMetricsToFile", zap.Error(err))
-			}
+	}
+	if st, ok := storage.(retention.Store); ok && cfg.Retention.Interval > 0 {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			retention.New(cfg, st).Run(jobsCtx)
 		}()
 	}
 
-	service := service.New(storage)
+	service := service.New(storage, serviceOpts...)
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		service.Run(jobsCtx)
+	}()
 	r := api.NewRouter(cfg, service, mw)
 
-	listenErr := make(chan error, 1)
-	listenSignals := make(chan os.Signal, 1)
-	signal.Notify(listenSignals, syscall.SIGINT, syscall.SIGTERM)
+	listenErr := make(chan error, 3)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	go func() {
 		listenErr <- r.ServeRouter()
 	}()
 
 	zap.L().Sugar().Infof("The server is listening and serving the address %s", cfg.Server.Address)
+
+	var g *grpcapi.Server
+	if cfg.GRPC.Address != "" {
+		g = grpcapi.NewServer(cfg, service)
+		go func() {
+			listenErr <- g.ServeGRPC()
+		}()
+
+		zap.L().Sugar().Infof("The gRPC server is listening and serving the address %s", cfg.GRPC.Address)
+	}
+
+	var sd *statsdapi.Server
+	if cfg.StatsD.Address != "" {
+		sd = statsdapi.NewServer(cfg, service)
+		go func() {
+			listenErr <- sd.ServeStatsD()
+		}()
+
+		zap.L().Sugar().Infof("The StatsD listener is receiving on the address %s", cfg.StatsD.Address)
+	}
+
 	select {
-	case sig := <-listenSignals:
-		zap.L().Warn("received signal", zap.String("signal", sig.String()))
-		storage.Close()
+	case <-ctx.Done():
+		zap.L().Warn("received shutdown signal")
 	case err := <-listenErr:
 		zap.L().Error("", zap.Error(err))
-		storage.Close()
 	}
+
+	// The listeners drain first so that the final snapshot has every
+	// accepted update, the store is closed last.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := r.Shutdown(shutdownCtx); err != nil {
+		zap.L().Error("router.Shutdown", zap.Error(err))
+	}
+	if g != nil {
+		g.Shutdown(shutdownCtx)
+	}
+	if sd != nil {
+		sd.Shutdown(shutdownCtx)
+	}
+	if err := service.Flush(shutdownCtx); err != nil {
+		zap.L().Error("service.Flush", zap.Error(err))
+	}
+
+	stopJobs()
+	jobs.Wait()
+	if backup.Enabled() {
+		if err := backup.SaveMetricsToFile(shutdownCtx); err != nil {
+			zap.L().Error("backup.SaveMetricsToFile", zap.Error(err))
+		}
+		if err := backup.Close(); err != nil {
+			zap.L().Error("backup.Close", zap.Error(err))
+		}
+	}
+	storage.Close()
+	zap.L().Info("server stopped")
 }
@@ -0,0 +1,9 @@
+BEGIN TRANSACTION;
+
+DROP INDEX gauge_metrics_series_idx;
+DROP INDEX counter_metrics_series_idx;
+
+ALTER TABLE gauge_metrics DROP COLUMN labels;
+ALTER TABLE counter_metrics DROP COLUMN labels;
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN TRANSACTION;
+
+ALTER TABLE gauge_metrics ADD COLUMN labels JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE counter_metrics ADD COLUMN labels JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX gauge_metrics_series_idx ON gauge_metrics (name, labels, updated_at);
+CREATE INDEX counter_metrics_series_idx ON counter_metrics (name, labels, updated_at);
+
+COMMIT;
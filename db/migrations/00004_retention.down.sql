@@ -0,0 +1,12 @@
+BEGIN TRANSACTION;
+
+DROP INDEX gauge_metrics_updated_at_idx;
+DROP INDEX counter_metrics_updated_at_idx;
+
+DROP TABLE gauge_metrics_1m;
+DROP TABLE gauge_metrics_1h;
+DROP TABLE counter_metrics_1m;
+DROP TABLE counter_metrics_1h;
+DROP TABLE counter_metrics_archive;
+
+COMMIT;
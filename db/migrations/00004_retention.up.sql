@@ -0,0 +1,60 @@
+BEGIN TRANSACTION;
+
+CREATE TABLE gauge_metrics_1m(
+    name VARCHAR(200) NOT NULL,
+    labels JSONB NOT NULL DEFAULT '{}',
+    bucket BIGINT NOT NULL,
+    avg DOUBLE PRECISION NOT NULL,
+    min DOUBLE PRECISION NOT NULL,
+    max DOUBLE PRECISION NOT NULL,
+    last DOUBLE PRECISION NOT NULL,
+    count BIGINT NOT NULL,
+    PRIMARY KEY (name, labels, bucket)
+);
+
+CREATE TABLE gauge_metrics_1h(
+    name VARCHAR(200) NOT NULL,
+    labels JSONB NOT NULL DEFAULT '{}',
+    bucket BIGINT NOT NULL,
+    avg DOUBLE PRECISION NOT NULL,
+    min DOUBLE PRECISION NOT NULL,
+    max DOUBLE PRECISION NOT NULL,
+    last DOUBLE PRECISION NOT NULL,
+    count BIGINT NOT NULL,
+    PRIMARY KEY (name, labels, bucket)
+);
+
+CREATE TABLE counter_metrics_1m(
+    name VARCHAR(200) NOT NULL,
+    labels JSONB NOT NULL DEFAULT '{}',
+    bucket BIGINT NOT NULL,
+    value BIGINT NOT NULL,
+    count BIGINT NOT NULL,
+    PRIMARY KEY (name, labels, bucket)
+);
+
+CREATE TABLE counter_metrics_1h(
+    name VARCHAR(200) NOT NULL,
+    labels JSONB NOT NULL DEFAULT '{}',
+    bucket BIGINT NOT NULL,
+    value BIGINT NOT NULL,
+    count BIGINT NOT NULL,
+    PRIMARY KEY (name, labels, bucket)
+);
+
+-- Sums of counter deltas that are older than the retention of the hourly table.
+CREATE TABLE counter_metrics_archive(
+    name VARCHAR(200) NOT NULL,
+    labels JSONB NOT NULL DEFAULT '{}',
+    value BIGINT NOT NULL,
+    PRIMARY KEY (name, labels)
+);
+
+CREATE INDEX gauge_metrics_updated_at_idx ON gauge_metrics (updated_at);
+CREATE INDEX counter_metrics_updated_at_idx ON counter_metrics (updated_at);
+CREATE INDEX gauge_metrics_1m_bucket_idx ON gauge_metrics_1m (bucket);
+CREATE INDEX gauge_metrics_1h_bucket_idx ON gauge_metrics_1h (bucket);
+CREATE INDEX counter_metrics_1m_bucket_idx ON counter_metrics_1m (bucket);
+CREATE INDEX counter_metrics_1h_bucket_idx ON counter_metrics_1h (bucket);
+
+COMMIT;
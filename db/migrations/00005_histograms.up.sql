@@ -0,0 +1,14 @@
+BEGIN TRANSACTION;
+
+CREATE TABLE histogram_metrics(
+    name VARCHAR(200) NOT NULL,
+    labels JSONB NOT NULL DEFAULT '{}',
+    buckets DOUBLE PRECISION[] NOT NULL,
+    counts BIGINT[] NOT NULL,
+    sum DOUBLE PRECISION NOT NULL,
+    count BIGINT NOT NULL,
+    updated_at BIGINT NOT NULL,
+    PRIMARY KEY (name, labels)
+);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN TRANSACTION;
+
+DROP TABLE gauge_metrics_current;
+DROP TABLE counter_metrics_current;
+
+COMMIT;
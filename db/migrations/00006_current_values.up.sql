@@ -0,0 +1,38 @@
+BEGIN TRANSACTION;
+
+-- The current value of every series, maintained together with the history
+-- rows: the last gauge value and the running sum of the counter deltas.
+CREATE TABLE gauge_metrics_current(
+    name VARCHAR(200) NOT NULL,
+    labels JSONB NOT NULL DEFAULT '{}',
+    value DOUBLE PRECISION NOT NULL,
+    updated_at BIGINT NOT NULL,
+    PRIMARY KEY (name, labels)
+);
+
+CREATE TABLE counter_metrics_current(
+    name VARCHAR(200) NOT NULL,
+    labels JSONB NOT NULL DEFAULT '{}',
+    value BIGINT NOT NULL,
+    updated_at BIGINT NOT NULL,
+    PRIMARY KEY (name, labels)
+);
+
+INSERT INTO gauge_metrics_current (name, labels, value, updated_at)
+SELECT DISTINCT ON (name, labels) name, labels, value, updated_at
+FROM gauge_metrics
+ORDER BY name, labels, updated_at DESC, id DESC;
+
+INSERT INTO counter_metrics_current (name, labels, value, updated_at)
+SELECT name, labels, sum(value), max(updated_at) FROM (
+    SELECT name, labels, value, updated_at FROM counter_metrics
+    UNION ALL
+    SELECT name, labels, value, bucket FROM counter_metrics_1m
+    UNION ALL
+    SELECT name, labels, value, bucket FROM counter_metrics_1h
+    UNION ALL
+    SELECT name, labels, value, 0 FROM counter_metrics_archive
+) AS counter
+GROUP BY name, labels;
+
+COMMIT;
@@ -4,36 +4,90 @@ import (
 	"flag"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/VoevodinAnton/metrics/pkg/config"
+	"github.com/pkg/errors"
 )
 
 const (
 	defaultPollInterval   = 2
 	defaultReportInterval = 10
+	defaultRateLimit      = 1
+
+	TransportHTTP = "http"
+	TransportGRPC = "grpc"
+
+	defaultSources = "runtime,custom"
+	hostSource     = "host"
+
+	hostnameVar = "HOSTNAME"
 )
 
+var ErrInvalidPollInterval = errors.New("invalid source poll interval")
+
+// Source selects a registered metrics source. A zero PollInterval means
+// the agent poll interval.
+type Source struct {
+	Name         string
+	PollInterval time.Duration
+}
+
 type Config struct {
 	Logger         *config.Logger
 	CustomMetrics  map[string]string
+	Labels         map[string]string
 	RuntimeMetrics map[string]string
+	Sources        []Source
+	RuntimeInclude []string
+	RuntimeExclude []string
 	ServerAddress  string
+	Key            string
+	CryptoKey      string
+	GRPCAddress    string
+	Transport      string
 	PollInterval   time.Duration
 	ReportInterval time.Duration
+	RateLimit      int
 }
 
-func InitConfig() *Config {
-	var serverAddress string
-	var reportInterval, pollInterval int
+func InitConfig() (*Config, error) {
+	var serverAddress, grpcAddress, transport, labels, key, cryptoKey, sources string
+	var runtimeInclude, runtimeExclude string
+	var reportInterval, pollInterval, rateLimit int
+	var hostMetrics bool
 
 	envServerAddress := os.Getenv("ADDRESS")
 	envReportInterval := os.Getenv("REPORT_INTERVAL")
 	envPollInterval := os.Getenv("POLL_INTERVAL")
+	envGRPCAddress := os.Getenv("GRPC_ADDRESS")
+	envTransport := os.Getenv("TRANSPORT")
+	envLabels := os.Getenv("LABELS")
+	envKey := os.Getenv("KEY")
+	envCryptoKey := os.Getenv("CRYPTO_KEY")
+	envRateLimit := os.Getenv("RATE_LIMIT")
+	envHostMetrics := os.Getenv("HOST_METRICS")
+	envSources := os.Getenv("SOURCES")
+	envRuntimeInclude := os.Getenv("RUNTIME_METRICS_INCLUDE")
+	envRuntimeExclude := os.Getenv("RUNTIME_METRICS_EXCLUDE")
 
 	flag.StringVar(&serverAddress, "a", "localhost:8080", "HTTP server endpoint address")
 	flag.IntVar(&reportInterval, "r", defaultReportInterval, "Report interval in seconds")
 	flag.IntVar(&pollInterval, "p", defaultPollInterval, "Poll interval in seconds")
+	flag.IntVar(&rateLimit, "rate-limit", defaultRateLimit, "Max number of concurrent outgoing requests")
+	flag.StringVar(&grpcAddress, "g", "localhost:3200", "gRPC server endpoint address")
+	flag.StringVar(&transport, "t", TransportHTTP, "Transport used to upload metrics: http or grpc")
+	flag.StringVar(&key, "k", "", "Key to sign requests with HMAC-SHA256")
+	flag.StringVar(&cryptoKey, "crypto-key", "", "Path to server RSA public key to encrypt requests")
+	flag.StringVar(&labels, "l", "", "Labels attached to every metric, e.g. hostname=$HOSTNAME,instance=agent-1")
+	flag.BoolVar(&hostMetrics, "host-metrics", false, "Collect host CPU, memory, disk and network metrics from /proc")
+	flag.StringVar(&sources, "sources", defaultSources,
+		"Metrics sources with optional poll intervals: runtime, runtimemetrics, custom, host, e.g. runtime,custom,host:10s")
+	flag.StringVar(&runtimeInclude, "runtime-include", "",
+		"Comma-separated runtime/metrics name patterns collected by the runtimemetrics source, e.g. /gc/*,/sched/*")
+	flag.StringVar(&runtimeExclude, "runtime-exclude", "",
+		"Comma-separated runtime/metrics name patterns skipped by the runtimemetrics source")
 	flag.Parse()
 
 	if envServerAddress != "" {
@@ -45,11 +99,57 @@ func InitConfig() *Config {
 	if envPollInterval != "" {
 		pollInterval, _ = strconv.Atoi(envPollInterval)
 	}
+	if envGRPCAddress != "" {
+		grpcAddress = envGRPCAddress
+	}
+	if envTransport != "" {
+		transport = envTransport
+	}
+	if envLabels != "" {
+		labels = envLabels
+	}
+	if envKey != "" {
+		key = envKey
+	}
+	if envCryptoKey != "" {
+		cryptoKey = envCryptoKey
+	}
+	if envRateLimit != "" {
+		rateLimit, _ = strconv.Atoi(envRateLimit)
+	}
+	if envSources != "" {
+		sources = envSources
+	}
+	if envRuntimeInclude != "" {
+		runtimeInclude = envRuntimeInclude
+	}
+	if envRuntimeExclude != "" {
+		runtimeExclude = envRuntimeExclude
+	}
+	if envHostMetrics != "" {
+		hostMetrics, _ = strconv.ParseBool(envHostMetrics)
+	}
+	if rateLimit < 1 {
+		rateLimit = defaultRateLimit
+	}
+	parsedSources, err := parseSources(sources, hostMetrics)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Config{
 		ServerAddress:  serverAddress,
+		Key:            key,
+		CryptoKey:      cryptoKey,
+		GRPCAddress:    grpcAddress,
+		Transport:      transport,
+		Labels:         parseLabels(labels),
 		PollInterval:   time.Duration(pollInterval) * time.Second,
 		ReportInterval: time.Duration(reportInterval) * time.Second,
+		RateLimit:      rateLimit,
+		Sources:        parsedSources,
+		RuntimeInclude: parseList(runtimeInclude),
+		RuntimeExclude: parseList(runtimeExclude),
 		RuntimeMetrics: map[string]string{
 			"Alloc":         "gauge",
 			"BuckHashSys":   "gauge",
@@ -87,5 +187,69 @@ func InitConfig() *Config {
 			Development: true,
 			Level:       "debug",
 		},
+	}, nil
+}
+
+// parseSources parses comma-separated name[:interval] pairs, the interval
+// must be positive. hostMetrics adds the host source if it is not listed.
+func parseSources(s string, hostMetrics bool) ([]Source, error) {
+	var sources []Source
+	for _, item := range strings.Split(s, ",") {
+		name, interval, hasInterval := strings.Cut(strings.TrimSpace(item), ":")
+		if name == "" {
+			continue
+		}
+		var pollInterval time.Duration
+		if hasInterval {
+			var err error
+			pollInterval, err = time.ParseDuration(interval)
+			if err != nil || pollInterval <= 0 {
+				return nil, errors.Wrapf(ErrInvalidPollInterval, "source %s: %q", name, interval)
+			}
+		}
+		if name == hostSource {
+			hostMetrics = false
+		}
+		sources = append(sources, Source{Name: name, PollInterval: pollInterval})
+	}
+	if hostMetrics {
+		sources = append(sources, Source{Name: hostSource})
+	}
+	return sources, nil
+}
+
+func parseList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseLabels parses comma-separated key=value pairs. Values may reference
+// environment variables; $HOSTNAME falls back to os.Hostname if unset.
+func parseLabels(s string) map[string]string {
+	if s == "" {
+		return nil
+	}
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, _ := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		labels[key] = os.Expand(strings.TrimSpace(value), expandLabelVar)
+	}
+	return labels
+}
+
+func expandLabelVar(name string) string {
+	value := os.Getenv(name)
+	if value == "" && name == hostnameVar {
+		value, _ = os.Hostname()
 	}
+	return value
 }
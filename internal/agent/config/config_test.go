@@ -0,0 +1,57 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSources(t *testing.T) {
+	tests := []struct {
+		name        string
+		sources     string
+		hostMetrics bool
+		want        []Source
+		wantErr     bool
+	}{
+		{
+			name:    "intervals are optional",
+			sources: "runtime, host:10s,",
+			want:    []Source{{Name: "runtime"}, {Name: "host", PollInterval: 10 * time.Second}},
+		},
+		{
+			name:        "host metrics add the host source",
+			sources:     "runtime",
+			hostMetrics: true,
+			want:        []Source{{Name: "runtime"}, {Name: "host"}},
+		},
+		{
+			name:    "unparsable interval",
+			sources: "runtime,host:abc",
+			wantErr: true,
+		},
+		{
+			name:    "negative interval",
+			sources: "host:-5s",
+			wantErr: true,
+		},
+		{
+			name:    "empty interval",
+			sources: "host:",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSources(tt.sources, tt.hostMetrics)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidPollInterval)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
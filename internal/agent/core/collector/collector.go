@@ -1,61 +1,98 @@
 package collector
 
 import (
-	"math/rand"
-	"reflect"
-	"runtime"
+	"context"
 	"sync"
 	"time"
 
+	"go.uber.org/zap"
 	reflect_copy "golang.design/x/reflect"
 
 	"github.com/VoevodinAnton/metrics/internal/agent/config"
 )
 
+type polledSource struct {
+	source       Source
+	name         string
+	pollInterval time.Duration
+}
+
+// Collector polls the configured sources, each on its own interval, and
+// aggregates their metrics for the uploader.
 type Collector struct {
 	gaugeMetrics   map[string]float64
 	counterMetrics map[string]int64
 	cfg            *config.Config
+	sources        []polledSource
 	sync.Mutex
 }
 
-func NewCollector(cfg *config.Config) *Collector {
-	return &Collector{
+func NewCollector(cfg *config.Config) (*Collector, error) {
+	c := &Collector{
 		cfg:            cfg,
 		gaugeMetrics:   make(map[string]float64),
 		counterMetrics: make(map[string]int64),
 	}
+	for _, sc := range cfg.Sources {
+		source, err := newSource(sc.Name, cfg)
+		if err != nil {
+			return nil, err
+		}
+		pollInterval := sc.PollInterval
+		if pollInterval == 0 {
+			pollInterval = cfg.PollInterval
+		}
+		c.sources = append(c.sources, polledSource{
+			name:         sc.Name,
+			source:       source,
+			pollInterval: pollInterval,
+		})
+	}
+
+	return c, nil
 }
 
-func (c *Collector) Run() {
-	ticker := time.NewTicker(c.cfg.PollInterval)
-	for range ticker.C {
-		c.updateMetrics()
+// Run polls the sources until ctx is done.
+func (c *Collector) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, ps := range c.sources {
+		wg.Add(1)
+		go func(ps polledSource) {
+			defer wg.Done()
+			c.poll(ctx, ps)
+		}(ps)
 	}
+	wg.Wait()
 }
 
-func (c *Collector) updateMetrics() {
-	c.Lock()
-	defer c.Unlock()
-	var memStats runtime.MemStats
-	runtime.ReadMemStats(&memStats)
-	memStatsValue := reflect.ValueOf(memStats)
-	for metricName := range c.cfg.RuntimeMetrics {
-		v := memStatsValue.FieldByName(metricName)
-
-		var floatValue float64
-		if v.CanUint() {
-			floatValue = float64(v.Uint())
-		}
-		if v.CanFloat() {
-			floatValue = v.Float()
+func (c *Collector) poll(ctx context.Context, ps polledSource) {
+	ticker := time.NewTicker(ps.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.collect(ps)
 		}
+	}
+}
 
-		c.gaugeMetrics[metricName] = floatValue
+func (c *Collector) collect(ps polledSource) {
+	metrics, err := ps.source.Collect()
+	if err != nil {
+		zap.L().Error("source.Collect", zap.String("source", ps.name), zap.Error(err))
+		return
 	}
 
-	c.gaugeMetrics["RandomValue"] = getRandomValue()
-	c.counterMetrics["PollCount"]++
+	c.Lock()
+	defer c.Unlock()
+	for name, value := range metrics.Gauges {
+		c.gaugeMetrics[name] = value
+	}
+	for name, delta := range metrics.Counters {
+		c.counterMetrics[name] += delta
+	}
 }
 
 func (c *Collector) GetGaugeMetrics() map[string]float64 {
@@ -70,16 +107,12 @@ func (c *Collector) GetCounterMetrics() map[string]int64 {
 	return reflect_copy.DeepCopy[map[string]int64](c.counterMetrics)
 }
 
-func (c *Collector) ResetCounter() {
+// ResetCounter subtracts the uploaded deltas from the counters, so that the
+// increments counted while they were being uploaded are kept.
+func (c *Collector) ResetCounter(sent map[string]int64) {
 	c.Lock()
 	defer c.Unlock()
-	for k := range c.counterMetrics {
-		c.counterMetrics[k] = 0
+	for k, delta := range sent {
+		c.counterMetrics[k] -= delta
 	}
 }
-
-func getRandomValue() float64 {
-	const value = 100
-	randValue := float64(rand.Intn(value))
-	return randValue
-}
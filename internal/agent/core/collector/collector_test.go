@@ -0,0 +1,83 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VoevodinAnton/metrics/internal/agent/config"
+)
+
+type testSource struct {
+	value float64
+}
+
+func (s *testSource) Collect() (Metrics, error) {
+	s.value++
+	return Metrics{
+		Gauges:   map[string]float64{"TestGauge": s.value},
+		Counters: map[string]int64{"TestCounter": 2},
+	}, nil
+}
+
+func init() {
+	Register("test", func(_ *config.Config) Source {
+		return &testSource{}
+	})
+}
+
+func TestNewCollector(t *testing.T) {
+	tests := []struct {
+		wantErr error
+		name    string
+		sources []config.Source
+	}{
+		{
+			name:    "registered sources",
+			sources: []config.Source{{Name: "runtime"}, {Name: "custom"}, {Name: "host"}, {Name: "test"}},
+		},
+		{
+			name:    "unknown source",
+			sources: []config.Source{{Name: "runtime"}, {Name: "unknown"}},
+			wantErr: ErrUnknownSource,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewCollector(&config.Config{Sources: tt.sources})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, c.sources, len(tt.sources))
+		})
+	}
+}
+
+func TestCollector_collect(t *testing.T) {
+	c, err := NewCollector(&config.Config{Sources: []config.Source{{Name: "test"}, {Name: "custom"}}})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		for _, ps := range c.sources {
+			c.collect(ps)
+		}
+	}
+
+	gauges := c.GetGaugeMetrics()
+	assert.Equal(t, float64(3), gauges["TestGauge"])
+	assert.Contains(t, gauges, "RandomValue")
+	counters := c.GetCounterMetrics()
+	assert.Equal(t, int64(6), counters["TestCounter"])
+	assert.Equal(t, int64(3), counters["PollCount"])
+
+	// the increments collected during the upload are kept
+	for _, ps := range c.sources {
+		c.collect(ps)
+	}
+	c.ResetCounter(counters)
+	assert.Equal(t, int64(2), c.GetCounterMetrics()["TestCounter"])
+	assert.Equal(t, int64(1), c.GetCounterMetrics()["PollCount"])
+}
@@ -0,0 +1,27 @@
+package collector
+
+import (
+	"math/rand"
+
+	"github.com/VoevodinAnton/metrics/internal/agent/config"
+)
+
+// customSource reports a random gauge and counts its polls.
+type customSource struct{}
+
+func newCustomSource(_ *config.Config) Source {
+	return customSource{}
+}
+
+func (customSource) Collect() (Metrics, error) {
+	return Metrics{
+		Gauges:   map[string]float64{"RandomValue": getRandomValue()},
+		Counters: map[string]int64{"PollCount": 1},
+	}, nil
+}
+
+func getRandomValue() float64 {
+	const value = 100
+	randValue := float64(rand.Intn(value))
+	return randValue
+}
@@ -0,0 +1,222 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/VoevodinAnton/metrics/internal/agent/config"
+)
+
+const (
+	defaultProcPath = "/proc"
+	sectorSize      = 512
+	bytesInKB       = 1024
+	percent         = 100
+)
+
+type cpuTimes struct {
+	idle  uint64
+	total uint64
+}
+
+// hostSource reads the host memory, CPU, disk and network statistics
+// from procfs. CPU utilization is measured between two consecutive polls.
+type hostSource struct {
+	prevCPU  map[string]cpuTimes
+	procPath string
+}
+
+func newHostSource(_ *config.Config) Source {
+	return &hostSource{
+		procPath: defaultProcPath,
+		prevCPU:  make(map[string]cpuTimes),
+	}
+}
+
+func (h *hostSource) Collect() (Metrics, error) {
+	metrics := make(map[string]float64)
+	readers := []func(map[string]float64) error{
+		h.readMemInfo,
+		h.readCPUStat,
+		h.readDiskStats,
+		h.readNetDev,
+	}
+	for _, read := range readers {
+		if err := read(metrics); err != nil {
+			return Metrics{}, err
+		}
+	}
+
+	return Metrics{Gauges: metrics}, nil
+}
+
+// readMemInfo reads /proc/meminfo, the values there are in kB.
+func (h *hostSource) readMemInfo(metrics map[string]float64) error {
+	fields := map[string]string{
+		"MemTotal":     "TotalMemory",
+		"MemFree":      "FreeMemory",
+		"MemAvailable": "AvailableMemory",
+	}
+	return h.scanFile("meminfo", func(line string) error {
+		key, value, ok := strings.Cut(line, ":")
+		name, known := fields[key]
+		if !ok || !known {
+			return nil
+		}
+		kb, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "parse meminfo %s", key)
+		}
+		metrics[name] = float64(kb * bytesInKB)
+		return nil
+	})
+}
+
+// readCPUStat reads the per-core lines of /proc/stat and reports
+// CPUutilization1..N in percent.
+func (h *hostSource) readCPUStat(metrics map[string]float64) error {
+	return h.scanFile("stat", func(line string) error {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") || fields[0] == "cpu" {
+			return nil
+		}
+		core, err := strconv.Atoi(strings.TrimPrefix(fields[0], "cpu"))
+		if err != nil {
+			return errors.Wrapf(err, "parse stat %s", fields[0])
+		}
+		var cur cpuTimes
+		for i, field := range fields[1:] {
+			v, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return errors.Wrapf(err, "parse stat %s", fields[0])
+			}
+			// idle and iowait
+			if i == 3 || i == 4 {
+				cur.idle += v
+			}
+			cur.total += v
+		}
+		prev := h.prevCPU[fields[0]]
+		h.prevCPU[fields[0]] = cur
+
+		metrics[fmt.Sprintf("CPUutilization%d", core+1)] = cpuUtilization(prev, cur)
+		return nil
+	})
+}
+
+// cpuUtilization returns the busy share of the time between two polls in
+// percent. The counters may go backwards, iowait does on some kernels, so
+// the deltas are signed and the result is clamped to [0, 100].
+func cpuUtilization(prev, cur cpuTimes) float64 {
+	total := float64(cur.total) - float64(prev.total)
+	if total <= 0 {
+		return 0
+	}
+	idle := math.Max(0, float64(cur.idle)-float64(prev.idle))
+	return math.Max(0, math.Min(percent, percent*(1-idle/total)))
+}
+
+// readDiskStats sums the bytes read and written by the whole disks
+// in /proc/diskstats, partitions and virtual devices are skipped.
+func (h *hostSource) readDiskStats(metrics map[string]float64) error {
+	var read, written uint64
+	err := h.scanFile("diskstats", func(line string) error {
+		fields := strings.Fields(line)
+		if len(fields) < 10 || !h.isDisk(fields[2]) {
+			return nil
+		}
+		sectorsRead, err := strconv.ParseUint(fields[5], 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "parse diskstats %s", fields[2])
+		}
+		sectorsWritten, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "parse diskstats %s", fields[2])
+		}
+		read += sectorsRead * sectorSize
+		written += sectorsWritten * sectorSize
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	metrics["DiskReadBytes"] = float64(read)
+	metrics["DiskWrittenBytes"] = float64(written)
+
+	return nil
+}
+
+// isDisk reports whether the block device is a whole disk: it has
+// a device directory in sysfs. Without sysfs loop and ram devices are
+// the only ones skipped.
+func (h *hostSource) isDisk(name string) bool {
+	if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+		return false
+	}
+	sysBlock := filepath.Join(filepath.Dir(h.procPath), "sys", "block")
+	if _, err := os.Stat(sysBlock); err != nil {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(sysBlock, name, "device"))
+	return err == nil
+}
+
+// readNetDev sums the bytes received and sent by all interfaces except loopback.
+func (h *hostSource) readNetDev(metrics map[string]float64) error {
+	var received, transmitted uint64
+	err := h.scanFile("net/dev", func(line string) error {
+		iface, counters, ok := strings.Cut(line, ":")
+		iface = strings.TrimSpace(iface)
+		if !ok || iface == "lo" {
+			return nil
+		}
+		fields := strings.Fields(counters)
+		if len(fields) < 9 {
+			return nil
+		}
+		rx, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "parse net/dev %s", iface)
+		}
+		tx, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "parse net/dev %s", iface)
+		}
+		received += rx
+		transmitted += tx
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	metrics["NetReceivedBytes"] = float64(received)
+	metrics["NetTransmittedBytes"] = float64(transmitted)
+
+	return nil
+}
+
+func (h *hostSource) scanFile(name string, parse func(line string) error) error {
+	f, err := os.Open(filepath.Join(h.procPath, name))
+	if err != nil {
+		return errors.Wrap(err, "os.Open")
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if err := parse(scanner.Text()); err != nil {
+			return err
+		}
+	}
+
+	return errors.Wrap(scanner.Err(), "scanner.Err")
+}
@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testMemInfo = `MemTotal:        2048 kB
+MemFree:         1024 kB
+MemAvailable:    1536 kB
+Buffers:          100 kB
+`
+	testDiskStats = `   7       0 loop0 10 0 100 0 0 0 0 0 0 0 0
+   8       0 sda 100 0 2 0 50 0 4 0 0 0 0
+   8       1 sda1 90 0 1 0 40 0 3 0 0 0 0
+`
+	testNetDev = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:     500       5    0    0    0     0          0         0      500       5    0    0    0     0       0          0
+  eth0:    1000      10    0    0    0     0          0         0     2000      20    0    0    0     0       0          0
+`
+)
+
+func writeProcFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+func TestHostSource_Collect(t *testing.T) {
+	root := t.TempDir()
+	procPath := filepath.Join(root, "proc")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "sys", "block", "sda", "device"), 0o755))
+	writeProcFile(t, procPath, "meminfo", testMemInfo)
+	writeProcFile(t, procPath, "diskstats", testDiskStats)
+	writeProcFile(t, procPath, "net/dev", testNetDev)
+	writeProcFile(t, procPath, "stat", `cpu  200 0 100 700 0 0 0 0 0 0
+cpu0 100 0 50 350 0 0 0 0 0 0
+cpu1 100 0 50 350 0 0 0 0 0 0
+intr 0
+`)
+
+	h := &hostSource{procPath: procPath, prevCPU: make(map[string]cpuTimes)}
+
+	metrics, err := h.Collect()
+	require.NoError(t, err)
+	gauges := metrics.Gauges
+	assert.Equal(t, float64(2048*1024), gauges["TotalMemory"])
+	assert.Equal(t, float64(1024*1024), gauges["FreeMemory"])
+	assert.Equal(t, float64(1536*1024), gauges["AvailableMemory"])
+	assert.Equal(t, float64(2*512), gauges["DiskReadBytes"])
+	assert.Equal(t, float64(4*512), gauges["DiskWrittenBytes"])
+	assert.Equal(t, float64(1000), gauges["NetReceivedBytes"])
+	assert.Equal(t, float64(2000), gauges["NetTransmittedBytes"])
+	assert.InDelta(t, 30, gauges["CPUutilization1"], 0.001)
+	assert.InDelta(t, 30, gauges["CPUutilization2"], 0.001)
+
+	// the second poll reports the utilization since the first one
+	writeProcFile(t, procPath, "stat", `cpu  200 0 100 700 0 0 0 0 0 0
+cpu0 190 0 50 360 0 0 0 0 0 0
+cpu1 100 0 50 450 0 0 0 0 0 0
+`)
+	metrics, err = h.Collect()
+	require.NoError(t, err)
+	gauges = metrics.Gauges
+	assert.InDelta(t, 90, gauges["CPUutilization1"], 0.001)
+	assert.InDelta(t, 0, gauges["CPUutilization2"], 0.001)
+}
+
+func TestCPUUtilization(t *testing.T) {
+	tests := []struct {
+		name string
+		prev cpuTimes
+		cur  cpuTimes
+		want float64
+	}{
+		{name: "busy share", prev: cpuTimes{idle: 100, total: 200}, cur: cpuTimes{idle: 125, total: 300}, want: 75},
+		{name: "first poll", cur: cpuTimes{idle: 350, total: 500}, want: 30},
+		{name: "decreasing idle counter", prev: cpuTimes{idle: 100, total: 200}, cur: cpuTimes{idle: 90, total: 300}, want: 100},
+		{name: "idle grows faster than total", prev: cpuTimes{idle: 100, total: 200}, cur: cpuTimes{idle: 250, total: 300}, want: 0},
+		{name: "decreasing total", prev: cpuTimes{idle: 100, total: 300}, cur: cpuTimes{idle: 100, total: 200}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.want, cpuUtilization(tt.prev, tt.cur), 0.001)
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package collector
+
+import (
+	"reflect"
+	"runtime"
+
+	"github.com/VoevodinAnton/metrics/internal/agent/config"
+)
+
+// runtimeSource reads the runtime.MemStats fields listed in cfg.RuntimeMetrics.
+type runtimeSource struct {
+	metrics map[string]string
+}
+
+func newRuntimeSource(cfg *config.Config) Source {
+	return &runtimeSource{metrics: cfg.RuntimeMetrics}
+}
+
+func (s *runtimeSource) Collect() (Metrics, error) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	memStatsValue := reflect.ValueOf(memStats)
+
+	gauges := make(map[string]float64, len(s.metrics))
+	for metricName := range s.metrics {
+		v := memStatsValue.FieldByName(metricName)
+
+		var floatValue float64
+		if v.CanUint() {
+			floatValue = float64(v.Uint())
+		}
+		if v.CanFloat() {
+			floatValue = v.Float()
+		}
+
+		gauges[metricName] = floatValue
+	}
+
+	return Metrics{Gauges: gauges}, nil
+}
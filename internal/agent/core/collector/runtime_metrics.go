@@ -0,0 +1,141 @@
+package collector
+
+import (
+	"math"
+	"path"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+
+	"github.com/VoevodinAnton/metrics/internal/agent/config"
+)
+
+// histogramQuantiles are reported for every runtime/metrics histogram.
+var histogramQuantiles = []struct {
+	suffix string
+	q      float64
+}{
+	{suffix: "p50", q: 0.5},
+	{suffix: "p90", q: 0.9},
+	{suffix: "p99", q: 0.99},
+}
+
+var (
+	metricNameReplacer  = strings.NewReplacer("/", "_", ":", "_", "-", "_", ".", "_", "*", "")
+	bucketBoundReplacer = strings.NewReplacer(".", "_", "-", "_", "+", "")
+)
+
+// runtimeMetricsSource reads every supported runtime/metrics sample
+// that matches the include patterns and none of the exclude patterns.
+// A histogram is flattened into its observations count, its cumulative
+// bucket counts and its quantiles.
+type runtimeMetricsSource struct {
+	names   map[string]string
+	samples []metrics.Sample
+}
+
+func newRuntimeMetricsSource(cfg *config.Config) Source {
+	s := &runtimeMetricsSource{names: make(map[string]string)}
+	for _, d := range metrics.All() {
+		if d.Kind == metrics.KindBad || !matchRuntimeMetric(d.Name, cfg.RuntimeInclude, cfg.RuntimeExclude) {
+			continue
+		}
+		s.samples = append(s.samples, metrics.Sample{Name: d.Name})
+		s.names[d.Name] = runtimeMetricName(d.Name)
+	}
+	return s
+}
+
+func (s *runtimeMetricsSource) Collect() (Metrics, error) {
+	metrics.Read(s.samples)
+
+	gauges := make(map[string]float64, len(s.samples))
+	for _, sample := range s.samples {
+		name := s.names[sample.Name]
+		switch sample.Value.Kind() {
+		case metrics.KindUint64:
+			gauges[name] = float64(sample.Value.Uint64())
+		case metrics.KindFloat64:
+			gauges[name] = sample.Value.Float64()
+		case metrics.KindFloat64Histogram:
+			h := sample.Value.Float64Histogram()
+			var count uint64
+			for _, c := range h.Counts {
+				count += c
+			}
+			gauges[name+"_count"] = float64(count)
+			var cumulative uint64
+			for i, c := range h.Counts {
+				cumulative += c
+				// the last bucket is the count, an infinite bound is not a valid gauge name
+				if upper := h.Buckets[i+1]; !math.IsInf(upper, 0) {
+					gauges[name+"_bucket_le_"+bucketBound(upper)] = float64(cumulative)
+				}
+			}
+			for _, hq := range histogramQuantiles {
+				if v, ok := histogramQuantile(h, count, hq.q); ok {
+					gauges[name+"_"+hq.suffix] = v
+				}
+			}
+		case metrics.KindBad:
+		}
+	}
+
+	return Metrics{Gauges: gauges}, nil
+}
+
+// matchRuntimeMetric reports whether name matches any of the include
+// patterns, all names do if there are none, and none of the exclude ones.
+// Patterns are path.Match globs, a trailing /* matches the whole subtree.
+func matchRuntimeMetric(name string, include, exclude []string) bool {
+	matches := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+			if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasSuffix(prefix, "/") &&
+				strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+	return (len(include) == 0 || matches(include)) && !matches(exclude)
+}
+
+// runtimeMetricName turns /sched/latencies:seconds into sched_latencies_seconds.
+func runtimeMetricName(name string) string {
+	return metricNameReplacer.Replace(strings.TrimPrefix(name, "/"))
+}
+
+// bucketBound formats a bucket bound for a gauge name, e.g. 1e-06 as 1e_06
+// and 0.5 as 0_5.
+func bucketBound(bound float64) string {
+	return bucketBoundReplacer.Replace(strconv.FormatFloat(bound, 'g', -1, 64))
+}
+
+// histogramQuantile returns the upper bound of the bucket containing the
+// q-quantile, or its lower bound for the last, unbounded bucket. It reports
+// false if both bounds of the bucket are infinite: the value is unknown and
+// an infinite gauge cannot be encoded as JSON.
+func histogramQuantile(h *metrics.Float64Histogram, count uint64, q float64) (float64, bool) {
+	if count == 0 {
+		return 0, true
+	}
+	rank := uint64(math.Ceil(q * float64(count)))
+	var cumulative uint64
+	for i, c := range h.Counts {
+		cumulative += c
+		if cumulative < rank {
+			continue
+		}
+		if upper := h.Buckets[i+1]; !math.IsInf(upper, 0) {
+			return upper, true
+		}
+		if lower := h.Buckets[i]; !math.IsInf(lower, 0) {
+			return lower, true
+		}
+		return 0, false
+	}
+	return 0, true
+}
@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"math"
+	"runtime/metrics"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VoevodinAnton/metrics/internal/agent/config"
+)
+
+func TestMatchRuntimeMetric(t *testing.T) {
+	tests := []struct {
+		name    string
+		metric  string
+		include []string
+		exclude []string
+		want    bool
+	}{
+		{name: "no patterns", metric: "/gc/cycles/total:gc-cycles", want: true},
+		{name: "subtree", metric: "/gc/cycles/total:gc-cycles", include: []string{"/gc/*"}, want: true},
+		{name: "glob", metric: "/sched/goroutines:goroutines", include: []string{"/sched/*:goroutines"}, want: true},
+		{name: "not included", metric: "/sched/goroutines:goroutines", include: []string{"/gc/*"}, want: false},
+		{
+			name:    "excluded",
+			metric:  "/gc/cycles/total:gc-cycles",
+			include: []string{"/gc/*"},
+			exclude: []string{"/gc/cycles/*"},
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchRuntimeMetric(tt.metric, tt.include, tt.exclude))
+		})
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	h := &metrics.Float64Histogram{
+		Counts:  []uint64{5, 4, 1},
+		Buckets: []float64{0, 1, 2, math.Inf(1)},
+	}
+	unbounded := &metrics.Float64Histogram{
+		Counts:  []uint64{3},
+		Buckets: []float64{math.Inf(-1), math.Inf(1)},
+	}
+	tests := []struct {
+		name   string
+		h      *metrics.Float64Histogram
+		count  uint64
+		q      float64
+		want   float64
+		wantOK bool
+	}{
+		{name: "upper bound", h: h, count: 10, q: 0.5, want: 1, wantOK: true},
+		{name: "upper bound of the last bounded bucket", h: h, count: 10, q: 0.9, want: 2, wantOK: true},
+		{name: "lower bound of the unbounded bucket", h: h, count: 10, q: 0.99, want: 2, wantOK: true},
+		{name: "no observations", h: h, count: 0, q: 0.5, want: 0, wantOK: true},
+		{name: "both bounds infinite", h: unbounded, count: 3, q: 0.5, wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := histogramQuantile(tt.h, tt.count, tt.q)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBucketBound(t *testing.T) {
+	assert.Equal(t, "0_5", bucketBound(0.5))
+	assert.Equal(t, "1e_06", bucketBound(1e-6))
+	assert.Equal(t, "1e21", bucketBound(1e21))
+	assert.Equal(t, "_2", bucketBound(-2))
+}
+
+func TestRuntimeMetricsSource_Collect(t *testing.T) {
+	s := newRuntimeMetricsSource(&config.Config{
+		RuntimeInclude: []string{"/sched/*"},
+		RuntimeExclude: []string{"/sched/gomaxprocs:threads"},
+	})
+
+	m, err := s.Collect()
+	require.NoError(t, err)
+	assert.Greater(t, m.Gauges["sched_goroutines_goroutines"], float64(0))
+	assert.Contains(t, m.Gauges, "sched_latencies_seconds_count")
+	assert.Contains(t, m.Gauges, "sched_latencies_seconds_p99")
+	var buckets int
+	for name, v := range m.Gauges {
+		if strings.HasPrefix(name, "sched_latencies_seconds_bucket_le_") {
+			buckets++
+			assert.LessOrEqual(t, v, m.Gauges["sched_latencies_seconds_count"], name)
+		}
+		assert.False(t, math.IsInf(v, 0) || math.IsNaN(v), name)
+	}
+	assert.Greater(t, buckets, 0)
+	assert.NotContains(t, m.Gauges, "sched_gomaxprocs_threads")
+	for name := range m.Gauges {
+		assert.True(t, strings.HasPrefix(name, "sched_"), name)
+	}
+}
@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/VoevodinAnton/metrics/internal/agent/config"
+)
+
+var ErrUnknownSource = errors.New("unknown metrics source")
+
+// Metrics is the result of one poll of a source. Gauges replace the stored
+// values, counters are increments added to them.
+type Metrics struct {
+	Gauges   map[string]float64
+	Counters map[string]int64
+}
+
+// Source is a set of metrics polled by the collector.
+type Source interface {
+	Collect() (Metrics, error)
+}
+
+// Factory creates a source from the agent config.
+type Factory func(cfg *config.Config) Source
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a source available by name for the agent config.
+// It panics if the name is already registered.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("collector: source %q registered twice", name))
+	}
+	registry[name] = factory
+}
+
+// Sources returns the sorted names of the registered sources.
+func Sources() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newSource(name string, cfg *config.Config) (Source, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownSource, "%q, available: %v", name, Sources())
+	}
+	return factory(cfg), nil
+}
+
+func init() {
+	Register("runtime", newRuntimeSource)
+	Register("custom", newCustomSource)
+	Register("host", newHostSource)
+	Register("runtimemetrics", newRuntimeMetricsSource)
+}
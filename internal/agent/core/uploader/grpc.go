@@ -0,0 +1,98 @@
+package uploader
+
+import (
+	"context"
+
+	"github.com/VoevodinAnton/metrics/internal/pkg/constants"
+	"github.com/VoevodinAnton/metrics/internal/pkg/domain"
+	pb "github.com/VoevodinAnton/metrics/internal/pkg/proto"
+	"github.com/VoevodinAnton/metrics/pkg/hash"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// UploadGRPC sends the metrics over gRPC, retrying transient failures.
+func (u *Uploader) UploadGRPC(ctx context.Context, m []domain.Metrics) error {
+	client, err := u.grpcClient()
+	if err != nil {
+		return err
+	}
+	req := &pb.UpdatesMetricsRequest{
+		Metrics: make([]*pb.Metric, 0, len(m)),
+	}
+	for _, metric := range m {
+		req.Metrics = append(req.Metrics, &pb.Metric{
+			Id:     metric.ID,
+			Type:   metric.MType,
+			Delta:  metric.Delta,
+			Value:  metric.Value,
+			Labels: metric.Labels,
+		})
+	}
+
+	return u.retrier.Do(ctx, func() error {
+		_, err := u.cb.Execute(func() (interface{}, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+			defer cancel()
+			_, err := client.UpdatesMetrics(ctx, req)
+			if err != nil {
+				return nil, errors.Wrap(err, "client.UpdatesMetrics")
+			}
+
+			return nil, nil //nolint: nilnil // currect return
+		})
+
+		return errors.Wrap(err, "cb.Execute")
+	})
+}
+
+func (u *Uploader) Close() error {
+	u.connMu.Lock()
+	defer u.connMu.Unlock()
+	if u.conn == nil {
+		return nil
+	}
+	err := u.conn.Close()
+	u.conn = nil
+	return errors.Wrap(err, "conn.Close")
+}
+
+func (u *Uploader) grpcClient() (pb.MetricsClient, error) {
+	u.connMu.Lock()
+	defer u.connMu.Unlock()
+	if u.conn == nil {
+		conn, err := grpc.Dial(u.cfg.GRPCAddress,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithUnaryInterceptor(u.signRequest))
+		if err != nil {
+			return nil, errors.Wrap(err, "grpc.Dial")
+		}
+		u.conn = conn
+	}
+
+	return pb.NewMetricsClient(u.conn), nil
+}
+
+// signRequest sends the HMAC-SHA256 of the deterministic protobuf encoding
+// of the request in the HashSHA256 metadata if a key is configured.
+func (u *Uploader) signRequest(
+	ctx context.Context, method string, req, reply any,
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption,
+) error {
+	if u.cfg.Key != "" {
+		msg, ok := req.(proto.Message)
+		if !ok {
+			return errors.New("unexpected request type")
+		}
+		data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+		if err != nil {
+			return errors.Wrap(err, "proto.Marshal")
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, constants.HashSHA256Header, hash.Sign([]byte(u.cfg.Key), data))
+	}
+
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
@@ -0,0 +1,142 @@
+package uploader
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/VoevodinAnton/metrics/internal/agent/config"
+	"github.com/VoevodinAnton/metrics/internal/pkg/constants"
+	"github.com/VoevodinAnton/metrics/internal/pkg/domain"
+	pb "github.com/VoevodinAnton/metrics/internal/pkg/proto"
+	"github.com/VoevodinAnton/metrics/pkg/hash"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type TestMetricsServer struct {
+	pb.UnimplementedMetricsServer
+	metrics []*pb.Metric
+	// key verifies the signature of the requests if set
+	key string
+}
+
+func (s *TestMetricsServer) UpdatesMetrics(
+	ctx context.Context, in *pb.UpdatesMetricsRequest,
+) (*pb.UpdatesMetricsResponse, error) {
+	if s.key != "" {
+		md, _ := metadata.FromIncomingContext(ctx)
+		data, err := proto.MarshalOptions{Deterministic: true}.Marshal(in)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if values := md.Get(constants.HashSHA256Header); len(values) == 0 || !hash.Verify([]byte(s.key), data, values[0]) {
+			return nil, status.Error(codes.Unauthenticated, "invalid signature")
+		}
+	}
+	s.metrics = append(s.metrics, in.GetMetrics()...)
+	return &pb.UpdatesMetricsResponse{}, nil
+}
+
+func NewGRPCServer(t *testing.T, srv pb.MetricsServer) string {
+	t.Helper()
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := grpc.NewServer()
+	pb.RegisterMetricsServer(s, srv)
+	go func() {
+		_ = s.Serve(listen)
+	}()
+	t.Cleanup(s.Stop)
+
+	return listen.Addr().String()
+}
+
+func TestUploader_UploadGRPC(t *testing.T) {
+	tests := []struct {
+		name            string
+		expectedMetrics []*pb.Metric
+		gaugeMetrics    map[string]float64
+		counterMetrics  map[string]int64
+	}{
+		{
+			name: "test gauge and counter",
+			expectedMetrics: []*pb.Metric{
+				{
+					Id:    "TestGauge",
+					Type:  domain.Gauge,
+					Value: toFloat64Pointer(2.5),
+				},
+				{
+					Id:    "TestCounter",
+					Type:  domain.Counter,
+					Delta: toInt64Pointer(1),
+				},
+			},
+			gaugeMetrics: map[string]float64{
+				"TestGauge": 2.5,
+			},
+			counterMetrics: map[string]int64{
+				"TestCounter": 1,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &TestMetricsServer{}
+			var cfg = &config.Config{
+				GRPCAddress: NewGRPCServer(t, srv),
+				Transport:   config.TransportGRPC,
+			}
+
+			var collector = &TestCollector{
+				gaugeMetrics:   tt.gaugeMetrics,
+				counterMetrics: tt.counterMetrics,
+			}
+
+			u := NewUploader(cfg, collector)
+			defer func() {
+				_ = u.Close()
+			}()
+
+			require.NoError(t, u.sendGaugeMetrics(context.Background()))
+			require.NoError(t, u.sendCounterMetrics(context.Background()))
+
+			require.Len(t, srv.metrics, len(tt.expectedMetrics))
+			for i, m := range tt.expectedMetrics {
+				require.Equal(t, m.GetId(), srv.metrics[i].GetId())
+				require.Equal(t, m.GetType(), srv.metrics[i].GetType())
+				require.Equal(t, m.Value, srv.metrics[i].Value)
+				require.Equal(t, m.Delta, srv.metrics[i].Delta)
+			}
+			require.Equal(t, int64(0), collector.counterMetrics["TestCounter"])
+		})
+	}
+}
+
+func TestUploader_UploadGRPCSigned(t *testing.T) {
+	srv := &TestMetricsServer{key: "secret"}
+	cfg := &config.Config{
+		GRPCAddress: NewGRPCServer(t, srv),
+		Transport:   config.TransportGRPC,
+		Key:         "secret",
+		Labels:      map[string]string{"host": "a", "dc": "b"},
+	}
+	u := NewUploader(cfg, &TestCollector{})
+	defer func() {
+		_ = u.Close()
+	}()
+
+	m := []domain.Metrics{{ID: "TestCounter", MType: domain.Counter, Delta: toInt64Pointer(1), Labels: cfg.Labels}}
+	require.NoError(t, u.UploadGRPC(context.Background(), m))
+	require.Len(t, srv.metrics, 1)
+
+	// the signature is checked, a wrong key is rejected
+	cfg.Key = "other"
+	require.Equal(t, codes.Unauthenticated, status.Code(errors.Cause(u.UploadGRPC(context.Background(), m))))
+}
@@ -0,0 +1,70 @@
+package uploader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	jobsPerReport = 2
+)
+
+type job struct {
+	send func(ctx context.Context) error
+	name string
+}
+
+// Run feeds the upload jobs to a pool of cfg.RateLimit workers on every
+// report tick. When ctx is done it queues a final upload of the gauges and
+// the counters collected since the last report and waits until the queued
+// jobs are sent, each of them without retries.
+func (u *Uploader) Run(ctx context.Context) {
+	jobs := make(chan job, u.cfg.RateLimit*jobsPerReport)
+
+	var wg sync.WaitGroup
+	for i := 0; i < u.cfg.RateLimit; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u.worker(ctx, jobs)
+		}()
+	}
+
+	ticker := time.NewTicker(u.cfg.ReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			jobs <- job{name: "sendGaugeMetrics", send: u.sendGaugeMetrics}
+			jobs <- job{name: "sendCounterMetrics", send: u.sendCounterMetrics}
+			close(jobs)
+			wg.Wait()
+			return
+		case <-ticker.C:
+			enqueue(jobs, job{name: "sendGaugeMetrics", send: u.sendGaugeMetrics})
+			enqueue(jobs, job{name: "sendCounterMetrics", send: u.sendCounterMetrics})
+		}
+	}
+}
+
+// enqueue drops the job if the queue is full. The jobs read the latest
+// values from the store, so nothing is lost: only the uploaded deltas are
+// subtracted from the counters, after a successful upload.
+func enqueue(jobs chan<- job, j job) {
+	select {
+	case jobs <- j:
+	default:
+		zap.L().Warn("upload queue is full, job dropped", zap.String("job", j.name))
+	}
+}
+
+func (u *Uploader) worker(ctx context.Context, jobs <-chan job) {
+	for j := range jobs {
+		if err := j.send(ctx); err != nil {
+			zap.L().Error(j.name, zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package uploader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VoevodinAnton/metrics/internal/agent/config"
+	"github.com/VoevodinAnton/metrics/pkg/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploader_sendGaugeMetricsRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantRequests int32
+		wantErr      bool
+	}{
+		{
+			name:         "retriable error then success",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK},
+			wantRequests: 3,
+		},
+		{
+			name:         "non-retriable error",
+			statuses:     []int{http.StatusInternalServerError},
+			wantRequests: 1,
+			wantErr:      true,
+		},
+		{
+			name: "attempts exhausted",
+			statuses: []int{
+				http.StatusServiceUnavailable, http.StatusServiceUnavailable,
+				http.StatusServiceUnavailable, http.StatusServiceUnavailable,
+			},
+			wantRequests: 4,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := requests.Add(1)
+				w.WriteHeader(tt.statuses[n-1])
+			}))
+			defer svr.Close()
+
+			cfg := &config.Config{
+				ServerAddress: strings.TrimPrefix(svr.URL, "http://"),
+			}
+			u := NewUploader(cfg, &TestCollector{gaugeMetrics: map[string]float64{"TestGauge": 1}})
+			u.retrier = retry.New(retry.WithBackoff(time.Millisecond, time.Millisecond, time.Millisecond))
+
+			err := u.sendGaugeMetrics(context.Background())
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantRequests, requests.Load())
+		})
+	}
+}
+
+func TestUploader_Run(t *testing.T) {
+	const rateLimit = 2
+
+	var inFlight, maxInFlight, requests atomic.Int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		requests.Add(1)
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer svr.Close()
+
+	cfg := &config.Config{
+		ServerAddress:  strings.TrimPrefix(svr.URL, "http://"),
+		ReportInterval: 5 * time.Millisecond,
+		RateLimit:      rateLimit,
+	}
+	u := NewUploader(cfg, &TestCollector{
+		gaugeMetrics:   map[string]float64{"TestGauge": 1},
+		counterMetrics: map[string]int64{"TestCounter": 1},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		u.Run(ctx)
+		close(done)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+
+	require.Positive(t, requests.Load())
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(rateLimit))
+	assert.Zero(t, inFlight.Load())
+}
+
+func TestUploader_RunFlushesOnCancel(t *testing.T) {
+	var requests atomic.Int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer svr.Close()
+
+	cfg := &config.Config{
+		ServerAddress:  strings.TrimPrefix(svr.URL, "http://"),
+		ReportInterval: time.Hour,
+		RateLimit:      1,
+	}
+	u := NewUploader(cfg, &TestCollector{
+		gaugeMetrics:   map[string]float64{"TestGauge": 1},
+		counterMetrics: map[string]int64{"TestCounter": 1},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	u.Run(ctx)
+
+	assert.Equal(t, int32(2), requests.Load())
+}
@@ -3,6 +3,8 @@ package uploader
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"crypto/rsa"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -12,9 +14,12 @@ import (
 	"github.com/VoevodinAnton/metrics/internal/agent/config"
 	"github.com/VoevodinAnton/metrics/internal/pkg/constants"
 	"github.com/VoevodinAnton/metrics/internal/pkg/domain"
+	"github.com/VoevodinAnton/metrics/pkg/encryption"
+	"github.com/VoevodinAnton/metrics/pkg/hash"
+	"github.com/VoevodinAnton/metrics/pkg/retry"
 	"github.com/pkg/errors"
 	"github.com/sony/gobreaker"
-	"go.uber.org/zap"
+	"google.golang.org/grpc"
 )
 
 const (
@@ -22,61 +27,78 @@ const (
 	clientTimeout     = 10 * time.Second
 )
 
+// StatusError is returned by Upload if the server responds with a status other than 200.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d %s", e.Code, http.StatusText(e.Code))
+}
+
+func (e *StatusError) StatusCode() int {
+	return e.Code
+}
+
 type Store interface {
 	GetGaugeMetrics() map[string]float64
 	GetCounterMetrics() map[string]int64
-	ResetCounter()
+	ResetCounter(sent map[string]int64)
 }
 
+type Option func(*Uploader)
+
 type Uploader struct {
-	cfg   *config.Config
-	cb    *gobreaker.CircuitBreaker
-	store Store
+	cfg       *config.Config
+	cb        *gobreaker.CircuitBreaker
+	store     Store
+	conn      *grpc.ClientConn
+	publicKey *rsa.PublicKey
+	retrier   *retry.Retrier
+	connMu    sync.Mutex
 	sync.Mutex
 }
 
-func NewUploader(cfg *config.Config, store Store) *Uploader {
+// WithPublicKey enables encryption of the uploaded HTTP bodies with the server key.
+func WithPublicKey(key *rsa.PublicKey) Option {
+	return func(u *Uploader) {
+		u.publicKey = key
+	}
+}
+
+func NewUploader(cfg *config.Config, store Store, opts ...Option) *Uploader {
 	var st gobreaker.Settings
 	st.Name = "HTTP REQUEST"
 	st.ReadyToTrip = func(counts gobreaker.Counts) bool {
 		failureRatio := float64(counts.TotalFailures) / float64(counts.Requests)
 		return counts.Requests > 20 && failureRatio >= 0.7
 	}
-	return &Uploader{
-		cfg:   cfg,
-		store: store,
-		cb:    gobreaker.NewCircuitBreaker(st),
+	u := &Uploader{
+		cfg:     cfg,
+		store:   store,
+		cb:      gobreaker.NewCircuitBreaker(st),
+		retrier: retry.New(),
 	}
-}
-
-func (u *Uploader) Run() {
-	ticker := time.NewTicker(u.cfg.ReportInterval)
-	for range ticker.C {
-		if err := u.sendGaugeMetrics(); err != nil {
-			zap.L().Error("sendGaugeMetrics", zap.Error(err))
-			continue
-		}
-		if err := u.sendCounterMetrics(); err != nil {
-			zap.L().Error("sendCounterMetrics", zap.Error(err))
-			continue
-		}
+	for _, opt := range opts {
+		opt(u)
 	}
+	return u
 }
 
-func (u *Uploader) sendGaugeMetrics() error {
+func (u *Uploader) sendGaugeMetrics(ctx context.Context) error {
 	metrics := u.store.GetGaugeMetrics()
 	metricsUpload := make([]domain.Metrics, 0, len(metrics))
 	for name, value := range metrics {
 		value := value
 		m := domain.Metrics{
-			ID:    name,
-			MType: domain.Gauge,
-			Value: &value,
+			ID:     name,
+			MType:  domain.Gauge,
+			Value:  &value,
+			Labels: u.cfg.Labels,
 		}
 		metricsUpload = append(metricsUpload, m)
 	}
-	url := fmt.Sprintf(updateURLTemplate, u.cfg.ServerAddress)
-	err := u.Upload(url, metricsUpload)
+	err := u.upload(ctx, metricsUpload)
 	if err != nil {
 		return errors.Wrap(err, "upload gauge")
 	}
@@ -84,7 +106,7 @@ func (u *Uploader) sendGaugeMetrics() error {
 	return nil
 }
 
-func (u *Uploader) sendCounterMetrics() error {
+func (u *Uploader) sendCounterMetrics(ctx context.Context) error {
 	u.Lock()
 	defer u.Unlock()
 	metrics := u.store.GetCounterMetrics()
@@ -92,23 +114,39 @@ func (u *Uploader) sendCounterMetrics() error {
 	for name, value := range metrics {
 		value := value
 		m := domain.Metrics{
-			ID:    name,
-			MType: domain.Counter,
-			Delta: &value,
+			ID:     name,
+			MType:  domain.Counter,
+			Delta:  &value,
+			Labels: u.cfg.Labels,
 		}
 		metricsUpload = append(metricsUpload, m)
 	}
-	url := fmt.Sprintf(updateURLTemplate, u.cfg.ServerAddress)
-	err := u.Upload(url, metricsUpload)
+	err := u.upload(ctx, metricsUpload)
 	if err != nil {
 		return errors.Wrap(err, "upload counter")
 	}
 
-	u.store.ResetCounter()
+	u.store.ResetCounter(metrics)
 	return nil
 }
 
-func (u *Uploader) Upload(url string, m []domain.Metrics) error {
+func (u *Uploader) upload(ctx context.Context, m []domain.Metrics) error {
+	if u.cfg.Transport == config.TransportGRPC {
+		return u.UploadGRPC(ctx, m)
+	}
+	url := fmt.Sprintf(updateURLTemplate, u.cfg.ServerAddress)
+	return u.Upload(ctx, url, m)
+}
+
+// Upload sends the metrics to url, retrying transient failures. ctx only
+// stops the waiting between attempts, a started request runs to completion.
+func (u *Uploader) Upload(ctx context.Context, url string, m []domain.Metrics) error {
+	return u.retrier.Do(ctx, func() error {
+		return u.uploadOnce(url, m)
+	})
+}
+
+func (u *Uploader) uploadOnce(url string, m []domain.Metrics) error {
 	_, err := u.cb.Execute(func() (interface{}, error) {
 		client := http.Client{
 			Timeout: clientTimeout,
@@ -127,22 +165,35 @@ func (u *Uploader) Upload(url string, m []domain.Metrics) error {
 		if err != nil {
 			return nil, errors.Wrap(err, "writer.Close")
 		}
-		req, err := http.NewRequest(http.MethodPost, url, &b)
+		body := b.Bytes()
+		if u.publicKey != nil {
+			body, err = encryption.Encrypt(u.publicKey, body)
+			if err != nil {
+				return nil, errors.Wrap(err, "encryption.Encrypt")
+			}
+		}
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
 		if err != nil {
 			return nil, errors.Wrap(err, "http.NewRequest")
 		}
 		req.Header.Set(constants.ContentTypeHeader, constants.ContentTypeJSON)
 		req.Header.Set(constants.ContentEncodingHeader, constants.GzipEncoding)
+		if u.publicKey != nil {
+			req.Header.Set(constants.EncryptionHeader, constants.EncryptionRSAAESGCM)
+		}
+		if u.cfg.Key != "" {
+			req.Header.Set(constants.HashSHA256Header, hash.Sign([]byte(u.cfg.Key), body))
+		}
 		resp, err := client.Do(req)
 		if err != nil {
 			return nil, errors.Wrap(err, "client.Do")
 		}
-		if resp.StatusCode != http.StatusOK {
-			return nil, errors.Wrap(errors.New("status code != 200"), resp.Status)
-		}
 		if err = resp.Body.Close(); err != nil {
 			return nil, errors.Wrap(err, "body.Close")
 		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, &StatusError{Code: resp.StatusCode}
+		}
 
 		return nil, nil //nolint: nilnil // currect return
 	})
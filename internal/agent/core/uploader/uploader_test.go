@@ -2,11 +2,13 @@ package uploader
 
 import (
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/VoevodinAnton/metrics/internal/agent/config"
@@ -17,6 +19,7 @@ import (
 type TestCollector struct {
 	gaugeMetrics   map[string]float64
 	counterMetrics map[string]int64
+	mu             sync.Mutex
 }
 
 func (c *TestCollector) GetGaugeMetrics() map[string]float64 {
@@ -24,15 +27,29 @@ func (c *TestCollector) GetGaugeMetrics() map[string]float64 {
 }
 
 func (c *TestCollector) GetCounterMetrics() map[string]int64 {
-	return c.counterMetrics
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counters := make(map[string]int64, len(c.counterMetrics))
+	for k, v := range c.counterMetrics {
+		counters[k] = v
+	}
+	return counters
 }
 
-func (c *TestCollector) ResetCounter() {
-	for k := range c.counterMetrics {
-		c.counterMetrics[k] = 0
+func (c *TestCollector) ResetCounter(sent map[string]int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, delta := range sent {
+		c.counterMetrics[k] -= delta
 	}
 }
 
+func (c *TestCollector) inc(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counterMetrics[name]++
+}
+
 func NewServer(t *testing.T, expectedMetrics []domain.Metrics) *httptest.Server {
 	t.Helper()
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -97,7 +114,7 @@ func TestUploader_sendCounterMetrics(t *testing.T) { //nolint: dupl // this is t
 
 			u := NewUploader(cfg, collector)
 
-			err := u.sendCounterMetrics()
+			err := u.sendCounterMetrics(context.Background())
 			if err != nil {
 				t.Error(err)
 			}
@@ -105,6 +122,19 @@ func TestUploader_sendCounterMetrics(t *testing.T) { //nolint: dupl // this is t
 	}
 }
 
+func TestUploader_sendCounterMetricsKeepsNewIncrements(t *testing.T) {
+	collector := &TestCollector{counterMetrics: map[string]int64{"PollCount": 3}}
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the agent keeps polling while the upload is in flight
+		collector.inc("PollCount")
+	}))
+	defer svr.Close()
+	u := NewUploader(&config.Config{ServerAddress: strings.TrimPrefix(svr.URL, "http://")}, collector)
+
+	require.NoError(t, u.sendCounterMetrics(context.Background()))
+	require.Equal(t, int64(1), collector.GetCounterMetrics()["PollCount"])
+}
+
 func TestUploader_sendGaugeMetrics(t *testing.T) { //nolint: dupl // this is test
 	tests := []struct {
 		name            string
@@ -140,7 +170,7 @@ func TestUploader_sendGaugeMetrics(t *testing.T) { //nolint: dupl // this is tes
 
 			u := NewUploader(cfg, collector)
 
-			err := u.sendGaugeMetrics()
+			err := u.sendGaugeMetrics(context.Background())
 			if err != nil {
 				t.Error(err)
 			}
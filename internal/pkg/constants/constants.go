@@ -3,9 +3,16 @@ package constants
 const (
 	GzipEncoding          = "gzip"
 	ContentTypeHeader     = "Content-Type"
+	AcceptHeader          = "Accept"
 	AcceptEncodingHeader  = "Accept-Encoding"
 	ContentEncodingHeader = "Content-Encoding"
+	HashSHA256Header      = "HashSHA256"
+	EncryptionHeader      = "Encryption"
+	EncryptionRSAAESGCM   = "rsa-oaep-aes-256-gcm"
 	ContentTypeText       = "text/plain; charset=utf-8"
 	ContentTypeHTML       = "text/html; charset=utf-8"
 	ContentTypeJSON       = "application/json"
+
+	ContentTypePrometheus  = "text/plain; version=0.0.4; charset=utf-8"
+	ContentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
 )
@@ -1,13 +1,55 @@
 package domain
 
+import "time"
+
 const (
-	Gauge   string = "gauge"
-	Counter string = "counter"
+	Gauge     string = "gauge"
+	Counter   string = "counter"
+	Histogram string = "histogram"
 )
 
 type Metrics struct {
-	Delta *int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
-	Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
-	ID    string   `json:"id"`              // имя метрики
-	MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
+	Delta     *int64            `json:"delta,omitempty"`     // значение метрики в случае передачи counter
+	Value     *float64          `json:"value,omitempty"`     // значение метрики в случае передачи gauge
+	Histogram *HistogramValue   `json:"histogram,omitempty"` // наблюдения в случае передачи histogram
+	Labels    map[string]string `json:"labels,omitempty"`    // метки, вместе с именем определяющие серию
+	ID        string            `json:"id"`                  // имя метрики
+	MType     string            `json:"type"`                // параметр, принимающий значение gauge, counter или histogram
+}
+
+type HistogramValue struct {
+	Buckets []float64 `json:"buckets"` // верхние границы корзин по возрастанию
+	Counts  []uint64  `json:"counts"`  // число наблюдений в каждой корзине и выше последней границы
+	Sum     float64   `json:"sum"`     // сумма наблюдений
+	Count   uint64    `json:"count"`   // число наблюдений
+}
+
+type HistoryRequest struct {
+	From   time.Time
+	To     time.Time
+	Labels map[string]string
+	ID     string
+	MType  string
+	Step   time.Duration
+}
+
+type History struct {
+	From   time.Time         `json:"from"`
+	To     time.Time         `json:"to"`
+	Labels map[string]string `json:"labels,omitempty"`
+	ID     string            `json:"id"`
+	MType  string            `json:"type"`
+	Step   string            `json:"step,omitempty"`
+	Points []HistoryPoint    `json:"points"`
+}
+
+type HistoryPoint struct {
+	Time  time.Time `json:"time"`
+	Value *float64  `json:"value,omitempty"` // значение gauge для сырых точек
+	Avg   *float64  `json:"avg,omitempty"`   // среднее значение gauge в интервале
+	Min   *float64  `json:"min,omitempty"`   // минимальное значение gauge в интервале
+	Max   *float64  `json:"max,omitempty"`   // максимальное значение gauge в интервале
+	Last  *float64  `json:"last,omitempty"`  // последнее значение gauge в интервале
+	Delta *int64    `json:"delta,omitempty"` // приращение counter
+	Rate  *float64  `json:"rate,omitempty"`  // приращение counter в секунду в интервале
 }
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+
+	"github.com/VoevodinAnton/metrics/internal/pkg/domain"
+	pb "github.com/VoevodinAnton/metrics/internal/pkg/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Handler struct {
+	pb.UnimplementedMetricsServer
+	service Service
+}
+
+func (h *Handler) UpdateMetric(ctx context.Context, in *pb.UpdateMetricRequest) (*pb.UpdateMetricResponse, error) {
+	metric, err := protoToMetric(in.GetMetric())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := h.service.UpdateMetric(ctx, metric); err != nil {
+		zap.L().Error("UpdateMetric service.UpdateMetric", zap.Error(err))
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &pb.UpdateMetricResponse{}, nil
+}
+
+func (h *Handler) UpdatesMetrics(ctx context.Context, in *pb.UpdatesMetricsRequest) (*pb.UpdatesMetricsResponse, error) {
+	metrics := make([]domain.Metrics, 0, len(in.GetMetrics()))
+	for _, m := range in.GetMetrics() {
+		metric, err := protoToMetric(m)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		metrics = append(metrics, *metric)
+	}
+	if err := h.service.UpdatesMetrics(ctx, &metrics); err != nil {
+		zap.L().Error("UpdatesMetrics service.UpdatesMetrics", zap.Error(err))
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &pb.UpdatesMetricsResponse{}, nil
+}
+
+func (h *Handler) GetMetric(ctx context.Context, in *pb.GetMetricRequest) (*pb.GetMetricResponse, error) {
+	if in.GetType() != domain.Gauge && in.GetType() != domain.Counter && in.GetType() != domain.Histogram {
+		return nil, status.Error(codes.InvalidArgument, ErrInvalidMetricType.Error())
+	}
+	metric, err := h.service.GetMetric(ctx, &domain.Metrics{
+		ID:     in.GetId(),
+		MType:  in.GetType(),
+		Labels: in.GetLabels(),
+	})
+	if err != nil {
+		zap.L().Error("GetMetric service.GetMetric", zap.Error(err))
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	return &pb.GetMetricResponse{Metric: metricToProto(metric)}, nil
+}
+
+func (h *Handler) GetMetrics(ctx context.Context, _ *pb.GetMetricsRequest) (*pb.GetMetricsResponse, error) {
+	metrics, err := h.service.GetMetrics(ctx)
+	if err != nil {
+		zap.L().Error("GetMetrics service.GetMetrics", zap.Error(err))
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	resp := &pb.GetMetricsResponse{
+		Metrics: make([]*pb.Metric, 0, len(*metrics)),
+	}
+	for i := range *metrics {
+		resp.Metrics = append(resp.Metrics, metricToProto(&(*metrics)[i]))
+	}
+
+	return resp, nil
+}
+
+func (h *Handler) Ping(ctx context.Context, _ *pb.PingRequest) (*pb.PingResponse, error) {
+	if err := h.service.Ping(ctx); err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	return &pb.PingResponse{}, nil
+}
+
+func protoToMetric(m *pb.Metric) (*domain.Metrics, error) {
+	metric := &domain.Metrics{
+		ID:     m.GetId(),
+		MType:  m.GetType(),
+		Labels: m.GetLabels(),
+	}
+
+	switch m.GetType() {
+	case domain.Gauge:
+		if m.Value == nil {
+			return nil, ErrInvalidMetricValue
+		}
+		metric.Value = m.Value
+	case domain.Counter:
+		if m.Delta == nil {
+			return nil, ErrInvalidMetricValue
+		}
+		metric.Delta = m.Delta
+	case domain.Histogram:
+		h := m.GetHistogram()
+		if h == nil {
+			return nil, ErrInvalidMetricValue
+		}
+		metric.Histogram = &domain.HistogramValue{
+			Buckets: h.GetBuckets(),
+			Counts:  h.GetCounts(),
+			Sum:     h.GetSum(),
+			Count:   h.GetCount(),
+		}
+	default:
+		return nil, ErrInvalidMetricType
+	}
+
+	return metric, nil
+}
+
+func metricToProto(m *domain.Metrics) *pb.Metric {
+	metric := &pb.Metric{
+		Id:     m.ID,
+		Type:   m.MType,
+		Delta:  m.Delta,
+		Value:  m.Value,
+		Labels: m.Labels,
+	}
+	if m.Histogram != nil {
+		metric.Histogram = &pb.Histogram{
+			Buckets: m.Histogram.Buckets,
+			Counts:  m.Histogram.Counts,
+			Sum:     m.Histogram.Sum,
+			Count:   m.Histogram.Count,
+		}
+	}
+
+	return metric
+}
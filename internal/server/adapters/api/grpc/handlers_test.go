@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/VoevodinAnton/metrics/internal/pkg/constants"
+	"github.com/VoevodinAnton/metrics/internal/pkg/domain"
+	pb "github.com/VoevodinAnton/metrics/internal/pkg/proto"
+	"github.com/VoevodinAnton/metrics/internal/server/adapters/store/memory"
+	"github.com/VoevodinAnton/metrics/internal/server/core/service"
+	"github.com/VoevodinAnton/metrics/pkg/hash"
+)
+
+func TestHandler_histograms(t *testing.T) {
+	ctx := context.Background()
+	h := &Handler{service: service.New(memory.NewStorage())}
+	histogram := &pb.Histogram{Buckets: []float64{0.1, 1}, Counts: []uint64{2, 1, 0}, Sum: 1.2, Count: 3}
+	labels := map[string]string{"host": "a"}
+
+	_, err := h.UpdatesMetrics(ctx, &pb.UpdatesMetricsRequest{Metrics: []*pb.Metric{
+		{Id: "Latency", Type: domain.Histogram, Labels: labels, Histogram: histogram},
+	}})
+	require.NoError(t, err)
+
+	_, err = h.UpdateMetric(ctx, &pb.UpdateMetricRequest{Metric: &pb.Metric{Id: "Latency", Type: domain.Histogram}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "a histogram without observations")
+
+	got, err := h.GetMetric(ctx, &pb.GetMetricRequest{Id: "Latency", Type: domain.Histogram, Labels: labels})
+	require.NoError(t, err)
+	assert.Equal(t, histogram.GetCounts(), got.GetMetric().GetHistogram().GetCounts())
+	assert.Equal(t, histogram.GetSum(), got.GetMetric().GetHistogram().GetSum())
+
+	all, err := h.GetMetrics(ctx, &pb.GetMetricsRequest{})
+	require.NoError(t, err)
+	require.Len(t, all.GetMetrics(), 1)
+	assert.Equal(t, histogram.GetBuckets(), all.GetMetrics()[0].GetHistogram().GetBuckets())
+	assert.Equal(t, histogram.GetCount(), all.GetMetrics()[0].GetHistogram().GetCount())
+}
+
+func TestSignatureInterceptor(t *testing.T) {
+	req := &pb.UpdatesMetricsRequest{Metrics: []*pb.Metric{
+		{Id: "Alloc", Type: domain.Gauge, Labels: map[string]string{"host": "a", "dc": "b"}},
+	}}
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	require.NoError(t, err)
+	handler := func(ctx context.Context, req any) (any, error) {
+		return &pb.UpdatesMetricsResponse{}, nil
+	}
+
+	tests := []struct {
+		name      string
+		key       string
+		signature string
+		wantCode  codes.Code
+	}{
+		{name: "no key", wantCode: codes.OK},
+		{name: "signed", key: "secret", signature: hash.Sign([]byte("secret"), data), wantCode: codes.OK},
+		{name: "unsigned", key: "secret", wantCode: codes.Unauthenticated},
+		{name: "signed with another key", key: "secret", signature: hash.Sign([]byte("other"), data), wantCode: codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.signature != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(constants.HashSHA256Header, tt.signature))
+			}
+			_, err := signatureInterceptor(tt.key)(ctx, req, &grpc.UnaryServerInfo{}, handler)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"net"
+
+	"github.com/VoevodinAnton/metrics/internal/pkg/constants"
+	"github.com/VoevodinAnton/metrics/internal/pkg/domain"
+	pb "github.com/VoevodinAnton/metrics/internal/pkg/proto"
+	"github.com/VoevodinAnton/metrics/internal/server/config"
+	"github.com/VoevodinAnton/metrics/pkg/hash"
+	"github.com/VoevodinAnton/metrics/pkg/logging"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	ErrInvalidMetricType  = errors.New("invalid metric type")
+	ErrInvalidMetricValue = errors.New("invalid metric value")
+	ErrInvalidSignature   = errors.New("invalid signature")
+)
+
+type Service interface {
+	GetMetric(ctx context.Context, metric *domain.Metrics) (*domain.Metrics, error)
+	UpdateMetric(ctx context.Context, metric *domain.Metrics) error
+	UpdatesMetrics(ctx context.Context, metrics *[]domain.Metrics) error
+	GetMetrics(ctx context.Context) (*[]domain.Metrics, error)
+	Ping(ctx context.Context) error
+}
+
+type Server struct {
+	cfg *config.Config
+	s   *grpc.Server
+}
+
+func NewServer(cfg *config.Config, service Service) *Server {
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			logging.UnaryServerInterceptor,
+			signatureInterceptor(cfg.Key),
+		),
+	)
+	pb.RegisterMetricsServer(s, &Handler{service: service})
+
+	return &Server{
+		cfg: cfg,
+		s:   s,
+	}
+}
+
+// signatureInterceptor verifies the HMAC-SHA256 of the request sent in the
+// HashSHA256 metadata, as the signed HTTP routes do with the body. The
+// request is signed in its deterministic protobuf encoding. It does nothing
+// if no key is configured.
+func signatureInterceptor(key string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if key == "" {
+			return handler(ctx, req)
+		}
+		msg, ok := req.(proto.Message)
+		if !ok {
+			return nil, status.Error(codes.Internal, "unexpected request type")
+		}
+		data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		var signature string
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get(constants.HashSHA256Header); len(values) > 0 {
+			signature = values[0]
+		}
+		if !hash.Verify([]byte(key), data, signature) {
+			return nil, status.Error(codes.Unauthenticated, ErrInvalidSignature.Error())
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func (s *Server) ServeGRPC() error {
+	listen, err := net.Listen("tcp", s.cfg.GRPC.Address)
+	if err != nil {
+		return errors.Wrap(err, "net.Listen")
+	}
+	err = s.s.Serve(listen)
+	return errors.Wrap(err, "grpc.Serve")
+}
+
+// Shutdown waits for the in-flight calls to finish until ctx is done,
+// then cancels the remaining ones.
+func (s *Server) Shutdown(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		s.s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.s.Stop()
+		<-stopped
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/VoevodinAnton/metrics/internal/pkg/domain"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// DeleteMetricHandler removes the series, e.g. DELETE /value/gauge/Alloc?hostname=a.
+func (h *Handler) DeleteMetricHandler(w http.ResponseWriter, r *http.Request) {
+	metric := domain.Metrics{
+		ID:     chi.URLParam(r, metricNameURLParam),
+		MType:  chi.URLParam(r, metricTypeURLParam),
+		Labels: labelsFromQuery(r),
+	}
+	if !isMetricType(metric.MType) {
+		http.Error(w, ErrInvalidMetricType.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := h.service.DeleteMetrics(r.Context(), &[]domain.Metrics{metric})
+	if err != nil {
+		zap.L().Error("DeleteMetricHandler service.DeleteMetrics", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if deleted == 0 {
+		http.Error(w, ErrMetricNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeleteJSONMetricsHandler removes the series listed in the body, the
+// values of the metrics are ignored. The missing ones are skipped.
+func (h *Handler) DeleteJSONMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	var metricsReq []domain.Metrics
+	if err := json.NewDecoder(r.Body).Decode(&metricsReq); err != nil {
+		zap.L().Error("DeleteJSONMetricsHandler json.NewDecoder", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, metric := range metricsReq {
+		if !isMetricType(metric.MType) {
+			http.Error(w, ErrInvalidMetricType.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if _, err := h.service.DeleteMetrics(r.Context(), &metricsReq); err != nil {
+		zap.L().Error("DeleteJSONMetricsHandler service.DeleteMetrics", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// ResetMetricHandler sets a counter to zero, e.g. POST /reset/counter/PollCount.
+func (h *Handler) ResetMetricHandler(w http.ResponseWriter, r *http.Request) {
+	if chi.URLParam(r, metricTypeURLParam) != domain.Counter {
+		http.Error(w, ErrInvalidMetricType.Error(), http.StatusBadRequest)
+		return
+	}
+	metric := domain.Metrics{
+		ID:     chi.URLParam(r, metricNameURLParam),
+		MType:  domain.Counter,
+		Labels: labelsFromQuery(r),
+	}
+
+	reset, err := h.service.ResetCounters(r.Context(), &[]domain.Metrics{metric})
+	if err != nil {
+		zap.L().Error("ResetMetricHandler service.ResetCounters", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if reset == 0 {
+		http.Error(w, ErrMetricNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func isMetricType(mType string) bool {
+	return mType == domain.Gauge || mType == domain.Counter || mType == domain.Histogram
+}
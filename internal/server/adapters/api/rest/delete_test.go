@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VoevodinAnton/metrics/internal/pkg/constants"
+	"github.com/VoevodinAnton/metrics/internal/pkg/domain"
+	"github.com/VoevodinAnton/metrics/internal/server/adapters/middlewares"
+	"github.com/VoevodinAnton/metrics/internal/server/config"
+	pkgconfig "github.com/VoevodinAnton/metrics/pkg/config"
+	"github.com/VoevodinAnton/metrics/pkg/hash"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *TestService) DeleteMetrics(ctx context.Context, metrics *[]domain.Metrics) (int, error) {
+	s.requested = *metrics
+	return s.found, nil
+}
+
+func (s *TestService) ResetCounters(ctx context.Context, metrics *[]domain.Metrics) (int, error) {
+	s.requested = *metrics
+	return s.found, nil
+}
+
+func TestHandler_DeleteHandlers(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		url           string
+		body          string
+		found         int
+		wantStatus    int
+		wantRequested []domain.Metrics
+	}{
+		{
+			name:       "delete a gauge with labels",
+			method:     http.MethodDelete,
+			url:        "/value/gauge/Alloc?hostname=a",
+			found:      1,
+			wantStatus: http.StatusOK,
+			wantRequested: []domain.Metrics{
+				{ID: "Alloc", MType: domain.Gauge, Labels: map[string]string{"hostname": "a"}},
+			},
+		},
+		{
+			name:          "delete a missing metric",
+			method:        http.MethodDelete,
+			url:           "/value/counter/PollCount",
+			wantStatus:    http.StatusNotFound,
+			wantRequested: []domain.Metrics{{ID: "PollCount", MType: domain.Counter}},
+		},
+		{
+			name:       "delete an invalid metric type",
+			method:     http.MethodDelete,
+			url:        "/value/unknown/Alloc",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "bulk delete skips the missing metrics",
+			method:     http.MethodPost,
+			url:        "/delete",
+			body:       `[{"id":"Alloc","type":"gauge","value":1},{"id":"Latency","type":"histogram"}]`,
+			found:      1,
+			wantStatus: http.StatusOK,
+			wantRequested: []domain.Metrics{
+				{ID: "Alloc", MType: domain.Gauge}, {ID: "Latency", MType: domain.Histogram},
+			},
+		},
+		{
+			name:       "bulk delete with an invalid metric type",
+			method:     http.MethodPost,
+			url:        "/delete",
+			body:       `[{"id":"Alloc","type":"gauge"},{"id":"Alloc","type":"unknown"}]`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "bulk delete with a malformed body",
+			method:     http.MethodPost,
+			url:        "/delete",
+			body:       `{"id":"Alloc"`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:          "reset a counter",
+			method:        http.MethodPost,
+			url:           "/reset/counter/PollCount",
+			found:         1,
+			wantStatus:    http.StatusOK,
+			wantRequested: []domain.Metrics{{ID: "PollCount", MType: domain.Counter}},
+		},
+		{
+			name:       "reset a gauge",
+			method:     http.MethodPost,
+			url:        "/reset/gauge/Alloc",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &TestService{found: tt.found}
+			h := Handler{service: service}
+			r := chi.NewRouter()
+			r.Delete("/value/{metricType}/{metricName}", h.DeleteMetricHandler)
+			r.Post("/delete", h.DeleteJSONMetricsHandler)
+			r.Post("/reset/{metricType}/{metricName}", h.ResetMetricHandler)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body)))
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantRequested != nil {
+				assert.Equal(t, len(tt.wantRequested), len(service.requested))
+				for i, want := range tt.wantRequested {
+					assert.Equal(t, want.ID, service.requested[i].ID)
+					assert.Equal(t, want.MType, service.requested[i].MType)
+					assert.Equal(t, want.Labels, service.requested[i].Labels)
+				}
+			}
+		})
+	}
+}
+
+func TestRouter_signedDelete(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		signed     bool
+		wantStatus int
+	}{
+		{name: "unsigned delete", method: http.MethodDelete, url: "/value/gauge/Alloc", wantStatus: http.StatusBadRequest},
+		{name: "unsigned reset", method: http.MethodPost, url: "/reset/counter/PollCount", wantStatus: http.StatusBadRequest},
+		{name: "signed delete", method: http.MethodDelete, url: "/value/gauge/Alloc", signed: true, wantStatus: http.StatusOK},
+		{name: "signed reset", method: http.MethodPost, url: "/reset/counter/PollCount", signed: true, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Key: "secret", Server: &pkgconfig.Server{}}
+			service := &TestService{found: 1}
+			router := NewRouter(cfg, service, middlewares.NewMiddlewareManager(cfg))
+
+			req := httptest.NewRequest(tt.method, tt.url, http.NoBody)
+			if tt.signed {
+				req.Header.Set(constants.HashSHA256Header, hash.Sign([]byte(cfg.Key), nil))
+			}
+			w := httptest.NewRecorder()
+			router.srv.Handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if !tt.signed {
+				assert.Empty(t, service.requested)
+			}
+		})
+	}
+}
@@ -10,7 +10,9 @@ import (
 
 	"github.com/VoevodinAnton/metrics/internal/pkg/constants"
 	"github.com/VoevodinAnton/metrics/internal/pkg/domain"
+	"github.com/VoevodinAnton/metrics/internal/server/models"
 	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
@@ -29,7 +31,7 @@ func (h *Handler) UpdateMetricHandler(w http.ResponseWriter, r *http.Request) {
 	metricName := chi.URLParam(r, metricNameURLParam)
 	metricValue := chi.URLParam(r, metricValueURLParam)
 
-	req := domain.Metrics{ID: metricName}
+	req := domain.Metrics{ID: metricName, Labels: labelsFromQuery(r)}
 
 	var err error
 	switch metricType {
@@ -63,8 +65,12 @@ func (h *Handler) UpdateMetricHandler(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetMetricHandler(w http.ResponseWriter, r *http.Request) {
 	metricType := chi.URLParam(r, metricTypeURLParam)
 	metricName := chi.URLParam(r, metricNameURLParam)
+	if !isMetricType(metricType) {
+		http.Error(w, ErrInvalidMetricType.Error(), http.StatusBadRequest)
+		return
+	}
 
-	metricReq := &domain.Metrics{ID: metricName, MType: metricType}
+	metricReq := &domain.Metrics{ID: metricName, MType: metricType, Labels: labelsFromQuery(r)}
 	metric, err := h.service.GetMetric(r.Context(), metricReq)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
@@ -77,6 +83,9 @@ func (h *Handler) GetMetricHandler(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprint(w, *metric.Delta)
 	case domain.Gauge:
 		fmt.Fprint(w, *metric.Value)
+	case domain.Histogram:
+		// the text form of a histogram is its observations count and sum
+		fmt.Fprint(w, metric.Histogram.Count, " ", metric.Histogram.Sum)
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -92,7 +101,7 @@ func (h *Handler) GetMetricsHandler(w http.ResponseWriter, r *http.Request) {
 	  <h1>Metric List</h1>
 	  <ul>
 		{{range $metric := .}}
-		  <li><strong>{{$metric.ID}}:</strong> {{if $metric.Value}} {{$metric.Value}} {{else}} {{$metric.Delta}} {{end}}</li>
+		  <li><strong>{{$metric.ID}}{{if $metric.Labels}} {{$metric.Labels}}{{end}}:</strong> {{if $metric.Value}} {{$metric.Value}} {{else if $metric.Histogram}} count {{$metric.Histogram.Count}}, sum {{$metric.Histogram.Sum}} {{else}} {{$metric.Delta}} {{end}}</li>
 		{{end}}
 	  </ul>
 	</body>
@@ -151,7 +160,7 @@ func (h *Handler) UpdateJSONMetricHandler(w http.ResponseWriter, r *http.Request
 	err := h.service.UpdateMetric(r.Context(), &metricUpdate)
 	if err != nil {
 		zap.L().Error("UpdateJSONMetricHandler service.UpdateMetric", zap.Error(err))
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), updateErrorStatus(err))
 		return
 	}
 
@@ -168,13 +177,39 @@ func (h *Handler) UpdatesJSONMetricsHandler(w http.ResponseWriter, r *http.Reque
 	err := h.service.UpdatesMetrics(r.Context(), &metricsReq)
 	if err != nil {
 		zap.L().Error("UpdatesJSONMetricsHandler service.UpdatesMetrics", zap.Error(err))
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), updateErrorStatus(err))
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
+// updateErrorStatus maps an update error to 400 if the request itself
+// is wrong and to 500 otherwise.
+func updateErrorStatus(err error) int {
+	if errors.Is(err, models.ErrInvalidHistogram) || errors.Is(err, models.ErrHistogramBucketMismatch) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// labelsFromQuery treats the URL query parameters except the reserved ones
+// as metric labels, e.g. /value/gauge/Alloc?hostname=a.
+func labelsFromQuery(r *http.Request, reserved ...string) map[string]string {
+	query := r.URL.Query()
+	for _, k := range reserved {
+		query.Del(k)
+	}
+	if len(query) == 0 {
+		return nil
+	}
+	labels := make(map[string]string, len(query))
+	for k := range query {
+		labels[k] = query.Get(k)
+	}
+	return labels
+}
+
 func (h *Handler) Ping(w http.ResponseWriter, r *http.Request) {
 	err := h.service.Ping(r.Context())
 	if err != nil {
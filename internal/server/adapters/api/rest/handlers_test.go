@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VoevodinAnton/metrics/internal/pkg/domain"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *TestService) GetMetric(ctx context.Context, metric *domain.Metrics) (*domain.Metrics, error) {
+	for _, m := range s.metrics {
+		if m.ID == metric.ID && m.MType == metric.MType {
+			return &m, nil
+		}
+	}
+	return nil, ErrMetricNotFound
+}
+
+func TestHandler_GetMetricHandler(t *testing.T) {
+	value := 2.5
+	delta := int64(5)
+	service := &TestService{metrics: []domain.Metrics{
+		{ID: "Alloc", MType: domain.Gauge, Value: &value},
+		{ID: "PollCount", MType: domain.Counter, Delta: &delta},
+		{ID: "Latency", MType: domain.Histogram, Histogram: &domain.HistogramValue{
+			Buckets: []float64{0.1, 1}, Counts: []uint64{2, 1, 1}, Sum: 3.5, Count: 4,
+		}},
+	}}
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+		want       string
+	}{
+		{name: "gauge", url: "/value/gauge/Alloc", wantStatus: http.StatusOK, want: "2.5"},
+		{name: "counter", url: "/value/counter/PollCount", wantStatus: http.StatusOK, want: "5"},
+		{name: "histogram count and sum", url: "/value/histogram/Latency", wantStatus: http.StatusOK, want: "4 3.5"},
+		{name: "missing metric", url: "/value/histogram/Missing", wantStatus: http.StatusNotFound},
+		{name: "unknown type", url: "/value/summary/Latency", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Handler{service: service}
+			r := chi.NewRouter()
+			r.Get("/value/{metricType}/{metricName}", h.GetMetricHandler)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, http.NoBody))
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, tt.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/VoevodinAnton/metrics/internal/pkg/constants"
+	"github.com/VoevodinAnton/metrics/internal/pkg/domain"
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	fromQueryParam = "from"
+	toQueryParam   = "to"
+	stepQueryParam = "step"
+
+	defaultHistoryRange = time.Hour
+	maxHistoryBuckets   = 11000
+)
+
+func (h *Handler) GetMetricHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	metricType := chi.URLParam(r, metricTypeURLParam)
+	if metricType != domain.Gauge && metricType != domain.Counter {
+		http.Error(w, ErrInvalidMetricType.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req, err := parseHistoryRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.ID = chi.URLParam(r, metricNameURLParam)
+	req.MType = metricType
+
+	history, err := h.service.GetMetricHistory(r.Context(), req)
+	if err != nil {
+		zap.L().Error("GetMetricHistoryHandler service.GetMetricHistory", zap.Error(err))
+		if errors.Is(err, models.ErrHistoryNotSupported) {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	historyResp, err := json.Marshal(history)
+	if err != nil {
+		zap.L().Error("GetMetricHistoryHandler json.Marshal", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(constants.ContentTypeHeader, constants.ContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(historyResp)
+}
+
+// parseHistoryRequest reads the time range from the query parameters.
+// from and to accept unix seconds or RFC 3339 and default to the last hour,
+// step accepts seconds or a Go duration and defaults to raw points.
+func parseHistoryRequest(r *http.Request) (*domain.HistoryRequest, error) {
+	query := r.URL.Query()
+
+	to, err := parseTime(query.Get(toQueryParam), time.Now())
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidHistoryRange, toQueryParam)
+	}
+	from, err := parseTime(query.Get(fromQueryParam), to.Add(-defaultHistoryRange))
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidHistoryRange, fromQueryParam)
+	}
+	if !from.Before(to) {
+		return nil, errors.Wrap(ErrInvalidHistoryRange, "from must be before to")
+	}
+
+	var step time.Duration
+	if s := query.Get(stepQueryParam); s != "" {
+		step, err = parseDuration(s)
+		if err != nil || step <= 0 {
+			return nil, errors.Wrap(ErrInvalidHistoryRange, stepQueryParam)
+		}
+		if to.Sub(from)/step > maxHistoryBuckets {
+			return nil, errors.Wrap(ErrInvalidHistoryRange, "too many buckets, increase step")
+		}
+	}
+
+	return &domain.HistoryRequest{
+		From:   from,
+		To:     to,
+		Step:   step,
+		Labels: labelsFromQuery(r, fromQueryParam, toQueryParam, stepQueryParam),
+	}, nil
+}
+
+func parseTime(s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := math.Modf(seconds)
+		return time.Unix(int64(sec), int64(frac*float64(time.Second))), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	return t, errors.Wrap(err, "time.Parse")
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(s)
+	return d, errors.Wrap(err, "time.ParseDuration")
+}
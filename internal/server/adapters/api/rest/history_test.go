@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/VoevodinAnton/metrics/internal/pkg/domain"
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_GetMetricHistoryHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		serviceErr  error
+		wantStatus  int
+		wantRequest *domain.HistoryRequest
+	}{
+		{
+			name:       "gauge buckets with labels",
+			url:        "/history/gauge/Alloc?from=1700000000&to=2023-11-14T23:13:20Z&step=1m&hostname=a",
+			wantStatus: http.StatusOK,
+			wantRequest: &domain.HistoryRequest{
+				ID:     "Alloc",
+				MType:  domain.Gauge,
+				From:   time.Unix(1700000000, 0),
+				To:     time.Unix(1700003600, 0),
+				Step:   time.Minute,
+				Labels: map[string]string{"hostname": "a"},
+			},
+		},
+		{
+			name:       "counter buckets with step in seconds",
+			url:        "/history/counter/PollCount?from=1700000000&to=1700000600&step=60",
+			wantStatus: http.StatusOK,
+			wantRequest: &domain.HistoryRequest{
+				ID:    "PollCount",
+				MType: domain.Counter,
+				From:  time.Unix(1700000000, 0),
+				To:    time.Unix(1700000600, 0),
+				Step:  time.Minute,
+			},
+		},
+		{
+			name:       "invalid metric type",
+			url:        "/history/unknown/Alloc",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "from after to",
+			url:        "/history/gauge/Alloc?from=1700000600&to=1700000000",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "too many buckets",
+			url:        "/history/gauge/Alloc?from=0&to=1700000000&step=1s",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "store without history",
+			url:        "/history/gauge/Alloc",
+			serviceErr: models.ErrHistoryNotSupported,
+			wantStatus: http.StatusNotImplemented,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &TestService{historyErr: tt.serviceErr}
+			h := Handler{service: service}
+			r := chi.NewRouter()
+			r.Get("/history/{metricType}/{metricName}", h.GetMetricHistoryHandler)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, http.NoBody))
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantRequest != nil {
+				assert.Equal(t, tt.wantRequest.ID, service.historyRequest.ID)
+				assert.Equal(t, tt.wantRequest.MType, service.historyRequest.MType)
+				assert.True(t, tt.wantRequest.From.Equal(service.historyRequest.From))
+				assert.True(t, tt.wantRequest.To.Equal(service.historyRequest.To))
+				assert.Equal(t, tt.wantRequest.Step, service.historyRequest.Step)
+				assert.Equal(t, tt.wantRequest.Labels, service.historyRequest.Labels)
+			}
+		})
+	}
+}
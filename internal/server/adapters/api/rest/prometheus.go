@@ -0,0 +1,232 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/VoevodinAnton/metrics/internal/pkg/constants"
+	"github.com/VoevodinAnton/metrics/internal/pkg/domain"
+	"go.uber.org/zap"
+)
+
+const (
+	openMetricsMediaType = "application/openmetrics-text"
+	counterTotalSuffix   = "_total"
+)
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (h *Handler) GetPrometheusMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	metrics, err := h.service.GetMetrics(r.Context())
+	if err != nil {
+		zap.L().Error("GetPrometheusMetricsHandler service.GetMetrics", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	openMetrics := acceptsOpenMetrics(r)
+
+	var body bytes.Buffer
+	writeExposition(&body, *metrics, openMetrics)
+
+	if openMetrics {
+		w.Header().Set(constants.ContentTypeHeader, constants.ContentTypeOpenMetrics)
+	} else {
+		w.Header().Set(constants.ContentTypeHeader, constants.ContentTypePrometheus)
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body.Bytes())
+}
+
+func acceptsOpenMetrics(r *http.Request) bool {
+	for _, acceptHeader := range r.Header.Values(constants.AcceptHeader) {
+		if strings.Contains(acceptHeader, openMetricsMediaType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+const (
+	histogramBucketSuffix = "_bucket"
+	histogramSumSuffix    = "_sum"
+	histogramCountSuffix  = "_count"
+	bucketLabel           = "le"
+)
+
+// sample is a single metric rendered as one or more exposition lines.
+type sample struct {
+	// name is the metric name before sanitizing.
+	name   string
+	family string
+	mType  string
+	labels string
+	lines  string
+}
+
+// writeExposition renders metrics in the Prometheus text format or,
+// if openMetrics is set, in the OpenMetrics text format.
+func writeExposition(w io.Writer, metrics []domain.Metrics, openMetrics bool) {
+	samples := make([]sample, 0, len(metrics))
+	for _, m := range metrics {
+		s := sample{
+			name:   m.ID,
+			family: sanitizeMetricName(m.ID),
+			mType:  m.MType,
+			labels: formatLabels(m.Labels),
+		}
+		switch m.MType {
+		case domain.Gauge:
+			if m.Value == nil {
+				continue
+			}
+			s.lines = fmt.Sprintf("%s%s %s\n", s.family, s.labels, formatFloat(*m.Value))
+		case domain.Counter:
+			if m.Delta == nil {
+				continue
+			}
+			name := s.family
+			if openMetrics {
+				s.family = strings.TrimSuffix(s.family, counterTotalSuffix)
+				name = s.family + counterTotalSuffix
+			}
+			s.lines = fmt.Sprintf("%s%s %d\n", name, s.labels, *m.Delta)
+		case domain.Histogram:
+			if m.Histogram == nil {
+				continue
+			}
+			s.lines = histogramLines(s.family, m.Labels, s.labels, m.Histogram)
+		default:
+			continue
+		}
+		samples = append(samples, s)
+	}
+
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].family != samples[j].family {
+			return samples[i].family < samples[j].family
+		}
+		if samples[i].name != samples[j].name {
+			return samples[i].name < samples[j].name
+		}
+		if samples[i].mType != samples[j].mType {
+			return samples[i].mType < samples[j].mType
+		}
+		return samples[i].labels < samples[j].labels
+	})
+
+	var name, family, mType string
+	for _, s := range samples {
+		if s.family != family {
+			name, family, mType = s.name, s.family, s.mType
+			fmt.Fprintf(w, "# TYPE %s %s\n", family, mType)
+		} else if s.name != name {
+			zap.L().Warn("metric with colliding sanitized name skipped",
+				zap.String("family", s.family), zap.String("name", s.name))
+			continue
+		} else if s.mType != mType {
+			zap.L().Warn("metric family with conflicting type skipped",
+				zap.String("family", s.family), zap.String("type", s.mType))
+			continue
+		}
+		fmt.Fprint(w, s.lines)
+	}
+
+	if openMetrics {
+		fmt.Fprint(w, "# EOF\n")
+	}
+}
+
+// histogramLines renders the cumulative buckets, the sum and the count of a histogram.
+func histogramLines(family string, labels map[string]string, formatted string, h *domain.HistogramValue) string {
+	bucketLabels := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		bucketLabels[k] = v
+	}
+
+	var b strings.Builder
+	var cumulative uint64
+	for i, count := range h.Counts {
+		cumulative += count
+		bucketLabels[bucketLabel] = "+Inf"
+		if i < len(h.Buckets) {
+			bucketLabels[bucketLabel] = formatFloat(h.Buckets[i])
+		}
+		fmt.Fprintf(&b, "%s%s%s %d\n", family, histogramBucketSuffix, formatLabels(bucketLabels), cumulative)
+	}
+	fmt.Fprintf(&b, "%s%s%s %s\n", family, histogramSumSuffix, formatted, formatFloat(h.Sum))
+	fmt.Fprintf(&b, "%s%s%s %d\n", family, histogramCountSuffix, formatted, h.Count)
+
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// formatLabels renders a label set as {name="value",...} sorted by label name.
+// Of the labels whose names collide after sanitizing only the first is kept.
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	written := make(map[string]struct{}, len(names))
+	var b strings.Builder
+	b.WriteByte('{')
+	for _, name := range names {
+		sanitized := strings.ReplaceAll(sanitizeMetricName(name), ":", "_")
+		if _, ok := written[sanitized]; ok {
+			continue
+		}
+		if len(written) > 0 {
+			b.WriteByte(',')
+		}
+		written[sanitized] = struct{}{}
+		b.WriteString(sanitized)
+		b.WriteString(`="`)
+		b.WriteString(labelValueReplacer.Replace(labels[name]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+// sanitizeMetricName replaces every character that is not allowed in
+// a Prometheus metric name with an underscore.
+func sanitizeMetricName(name string) string {
+	if name == "" {
+		return "_"
+	}
+
+	var b strings.Builder
+	b.Grow(len(name) + 1)
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == ':':
+			b.WriteRune(c)
+		case c >= '0' && c <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(c)
+		default:
+			b.WriteByte('_')
+		}
+	}
+
+	return b.String()
+}
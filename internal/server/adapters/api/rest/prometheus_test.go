@@ -0,0 +1,151 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VoevodinAnton/metrics/internal/pkg/constants"
+	"github.com/VoevodinAnton/metrics/internal/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type TestService struct {
+	Service
+	historyErr     error
+	historyRequest *domain.HistoryRequest
+	metrics        []domain.Metrics
+	// requested are the metrics of the last delete or reset, found of them exist.
+	requested []domain.Metrics
+	found     int
+}
+
+func (s *TestService) GetMetrics(ctx context.Context) (*[]domain.Metrics, error) {
+	metrics := append([]domain.Metrics(nil), s.metrics...)
+	return &metrics, nil
+}
+
+func (s *TestService) GetMetricHistory(ctx context.Context, req *domain.HistoryRequest) (*domain.History, error) {
+	s.historyRequest = req
+	if s.historyErr != nil {
+		return nil, s.historyErr
+	}
+	return &domain.History{ID: req.ID, MType: req.MType, Points: []domain.HistoryPoint{}}, nil
+}
+
+func TestHandler_GetPrometheusMetricsHandler(t *testing.T) {
+	value := 2.5
+	delta := int64(5)
+	metrics := []domain.Metrics{
+		{ID: "RandomValue", MType: domain.Gauge, Value: &value},
+		{ID: "PollCount", MType: domain.Counter, Delta: &delta},
+		{ID: "1st.metric-name", MType: domain.Gauge, Value: &value},
+		{ID: "Alloc", MType: domain.Gauge, Value: &value, Labels: map[string]string{"host": "b", "dc": `"x"`}},
+		{ID: "Alloc", MType: domain.Gauge, Value: &value, Labels: map[string]string{"host": "a"}},
+		{ID: "Latency", MType: domain.Histogram, Labels: map[string]string{"host": "a"}, Histogram: &domain.HistogramValue{
+			Buckets: []float64{0.1, 1}, Counts: []uint64{2, 1, 1}, Sum: 3.5, Count: 4,
+		}},
+	}
+
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+		want        string
+	}{
+		{
+			name:        "prometheus text format",
+			contentType: constants.ContentTypePrometheus,
+			want: "# TYPE Alloc gauge\nAlloc{dc=\"\\\"x\\\"\",host=\"b\"} 2.5\nAlloc{host=\"a\"} 2.5\n" +
+				"# TYPE Latency histogram\nLatency_bucket{host=\"a\",le=\"0.1\"} 2\n" +
+				"Latency_bucket{host=\"a\",le=\"1\"} 3\nLatency_bucket{host=\"a\",le=\"+Inf\"} 4\n" +
+				"Latency_sum{host=\"a\"} 3.5\nLatency_count{host=\"a\"} 4\n" +
+				"# TYPE PollCount counter\nPollCount 5\n" +
+				"# TYPE RandomValue gauge\nRandomValue 2.5\n" +
+				"# TYPE _1st_metric_name gauge\n_1st_metric_name 2.5\n",
+		},
+		{
+			name:        "openmetrics text format",
+			accept:      "application/openmetrics-text;version=1.0.0,text/plain;q=0.5",
+			contentType: constants.ContentTypeOpenMetrics,
+			want: "# TYPE Alloc gauge\nAlloc{dc=\"\\\"x\\\"\",host=\"b\"} 2.5\nAlloc{host=\"a\"} 2.5\n" +
+				"# TYPE Latency histogram\nLatency_bucket{host=\"a\",le=\"0.1\"} 2\n" +
+				"Latency_bucket{host=\"a\",le=\"1\"} 3\nLatency_bucket{host=\"a\",le=\"+Inf\"} 4\n" +
+				"Latency_sum{host=\"a\"} 3.5\nLatency_count{host=\"a\"} 4\n" +
+				"# TYPE PollCount counter\nPollCount_total 5\n" +
+				"# TYPE RandomValue gauge\nRandomValue 2.5\n" +
+				"# TYPE _1st_metric_name gauge\n_1st_metric_name 2.5\n" +
+				"# EOF\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Handler{service: &TestService{metrics: metrics}}
+
+			r := httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody)
+			if tt.accept != "" {
+				r.Header.Set(constants.AcceptHeader, tt.accept)
+			}
+			w := httptest.NewRecorder()
+			h.GetPrometheusMetricsHandler(w, r)
+
+			res := w.Result()
+			defer func() {
+				_ = res.Body.Close()
+			}()
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, tt.contentType, res.Header.Get(constants.ContentTypeHeader))
+			assert.Equal(t, tt.want, string(body))
+		})
+	}
+}
+
+func TestWriteExposition_sanitizedCollisions(t *testing.T) {
+	one, two := 1.0, 2.0
+	delta := int64(3)
+	tests := []struct {
+		name        string
+		metrics     []domain.Metrics
+		openMetrics bool
+		want        string
+	}{
+		{
+			name: "metric names",
+			metrics: []domain.Metrics{
+				{ID: "a_b", MType: domain.Gauge, Value: &two},
+				{ID: "a.b", MType: domain.Gauge, Value: &one},
+			},
+			want: "# TYPE a_b gauge\na_b 1\n",
+		},
+		{
+			name: "counter total suffix",
+			metrics: []domain.Metrics{
+				{ID: "hits_total", MType: domain.Counter, Delta: &delta},
+				{ID: "hits", MType: domain.Counter, Delta: &delta},
+			},
+			openMetrics: true,
+			want:        "# TYPE hits counter\nhits_total 3\n# EOF\n",
+		},
+		{
+			name: "label names",
+			metrics: []domain.Metrics{
+				{ID: "c", MType: domain.Gauge, Value: &one, Labels: map[string]string{"x_y": "2", "x.y": "1"}},
+			},
+			want: "# TYPE c gauge\nc{x_y=\"1\"} 1\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			writeExposition(&b, tt.metrics, tt.openMetrics)
+			assert.Equal(t, tt.want, b.String())
+		})
+	}
+}
@@ -14,8 +14,10 @@ import (
 )
 
 var (
-	ErrInvalidMetricType  = errors.New("invalid metric type")
-	ErrInvalidMetricValue = errors.New("invalid metric value")
+	ErrInvalidMetricType   = errors.New("invalid metric type")
+	ErrInvalidMetricValue  = errors.New("invalid metric value")
+	ErrInvalidHistoryRange = errors.New("invalid history range")
+	ErrMetricNotFound      = errors.New("metric not found")
 )
 
 type Service interface {
@@ -23,12 +25,15 @@ type Service interface {
 	UpdateMetric(ctx context.Context, metric *domain.Metrics) error
 	UpdatesMetrics(ctx context.Context, metrics *[]domain.Metrics) error
 	GetMetrics(ctx context.Context) (*[]domain.Metrics, error)
+	GetMetricHistory(ctx context.Context, req *domain.HistoryRequest) (*domain.History, error)
+	DeleteMetrics(ctx context.Context, metrics *[]domain.Metrics) (int, error)
+	ResetCounters(ctx context.Context, metrics *[]domain.Metrics) (int, error)
 	Ping(ctx context.Context) error
 }
 
 type Router struct {
 	cfg *config.Config
-	r   *chi.Mux
+	srv *http.Server
 }
 
 func NewRouter(cfg *config.Config, service Service, mw middlewares.MiddlewareManager) *Router {
@@ -48,21 +53,42 @@ func NewRouter(cfg *config.Config, service Service, mw middlewares.MiddlewareMan
 
 	gzipGroup := r.Group(nil)
 	gzipGroup.Use(mw.GzipCompressHandle, mw.GzipDecompressHandle)
-	gzipGroup.Post("/update", h.UpdateJSONMetricHandler)
 	gzipGroup.Get("/", h.GetMetricsHandler)
-	gzipGroup.Post("/value", h.GetJSONMetricHandler)
-	gzipGroup.Post("/updates", h.UpdatesJSONMetricsHandler)
+	gzipGroup.Get("/metrics", h.GetPrometheusMetricsHandler)
+	gzipGroup.Get("/history/{metricType}/{metricName}", h.GetMetricHistoryHandler)
+
+	signedGroup := r.Group(nil)
+	signedGroup.Use(mw.HashHandle, mw.GzipCompressHandle, mw.DecryptHandle, mw.GzipDecompressHandle)
+	signedGroup.Post("/update", h.UpdateJSONMetricHandler)
+	signedGroup.Post("/value", h.GetJSONMetricHandler)
+	signedGroup.Post("/updates", h.UpdatesJSONMetricsHandler)
+	signedGroup.Post("/delete", h.DeleteJSONMetricsHandler)
+	signedGroup.Delete("/value/{metricType}/{metricName}", h.DeleteMetricHandler)
+	signedGroup.Post("/reset/{metricType}/{metricName}", h.ResetMetricHandler)
 
 	utilGroup := r.Group(nil)
 	utilGroup.Get("/ping", h.Ping)
 
 	return &Router{
-		r:   r,
+		srv: &http.Server{
+			Addr:    cfg.Server.Address,
+			Handler: r,
+		},
 		cfg: cfg,
 	}
 }
 
+// ServeRouter blocks until the server fails or Shutdown is called.
 func (r *Router) ServeRouter() error {
-	err := http.ListenAndServe(r.cfg.Server.Address, r.r)
-	return errors.Wrap(err, "http.ListenAndServe")
+	err := r.srv.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return errors.Wrap(err, "srv.ListenAndServe")
+}
+
+// Shutdown stops accepting connections and waits for the in-flight
+// requests until ctx is done.
+func (r *Router) Shutdown(ctx context.Context) error {
+	return errors.Wrap(r.srv.Shutdown(ctx), "srv.Shutdown")
 }
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/VoevodinAnton/metrics/internal/pkg/domain"
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+)
+
+// defaultTimerBuckets are the histogram bounds of the timers, in milliseconds.
+var defaultTimerBuckets = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+type series struct {
+	labels map[string]string
+	name   string
+}
+
+type gaugeState struct {
+	series
+	value float64
+	// relative is set while the gauge has only been changed by relative
+	// updates, value is then the sum of the changes.
+	relative bool
+}
+
+type counterState struct {
+	series
+	delta float64
+	// idle is set while the counter only holds the fraction carried from
+	// the previous interval.
+	idle bool
+}
+
+type timerState struct {
+	series
+	histogram domain.HistogramValue
+}
+
+// aggregator accumulates the samples between two flushes. Counters are
+// summed and scaled by the sample rate, timers are collected into
+// histograms and gauges keep their last value. A gauge changed only by
+// relative updates in the interval is flushed as the change, to be applied
+// to the stored value.
+type aggregator struct {
+	counters map[string]*counterState
+	gauges   map[string]*gaugeState
+	timers   map[string]*timerState
+	buckets  []float64
+	mu       sync.Mutex
+}
+
+func newAggregator() *aggregator {
+	return &aggregator{
+		counters: make(map[string]*counterState),
+		gauges:   make(map[string]*gaugeState),
+		timers:   make(map[string]*timerState),
+		buckets:  defaultTimerBuckets,
+	}
+}
+
+func (a *aggregator) add(s sample) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := models.SeriesKey(s.name, s.labels)
+	ser := series{name: s.name, labels: s.labels}
+	switch s.mType {
+	case counterType:
+		c, ok := a.counters[key]
+		if !ok {
+			c = &counterState{series: ser}
+			a.counters[key] = c
+		}
+		c.delta += s.value / s.rate
+		c.idle = false
+	case gaugeType:
+		g, ok := a.gauges[key]
+		if !ok {
+			g = &gaugeState{series: ser, relative: s.relative}
+			a.gauges[key] = g
+		}
+		if s.relative {
+			g.value += s.value
+		} else {
+			g.value = s.value
+			g.relative = false
+		}
+	case timerType, histogramType:
+		t, ok := a.timers[key]
+		if !ok {
+			t = &timerState{series: ser, histogram: domain.HistogramValue{
+				Buckets: a.buckets,
+				Counts:  make([]uint64, len(a.buckets)+1),
+			}}
+			a.timers[key] = t
+		}
+		weight := uint64(math.Max(1, math.Round(1/s.rate)))
+		t.histogram.Counts[sort.SearchFloat64s(a.buckets, s.value)] += weight
+		t.histogram.Sum += s.value * float64(weight)
+		t.histogram.Count += weight
+	}
+}
+
+// restoreGaugeChange returns the change of a gauge that could not be applied
+// to the aggregator, so that the next flush applies it. A value set since
+// replaces it.
+func (a *aggregator) restoreGaugeChange(change domain.Metrics) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := models.SeriesKey(change.ID, change.Labels)
+	g, ok := a.gauges[key]
+	if !ok {
+		a.gauges[key] = &gaugeState{
+			series:   series{name: change.ID, labels: change.Labels},
+			value:    *change.Value,
+			relative: true,
+		}
+		return
+	}
+	if g.relative {
+		g.value += *change.Value
+	}
+}
+
+// flush returns the metrics aggregated since the previous flush and,
+// separately, the changes of the gauges that have no value set in the
+// interval.
+func (a *aggregator) flush() (metrics, relative []domain.Metrics) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	metrics = make([]domain.Metrics, 0, len(a.counters)+len(a.gauges)+len(a.timers))
+	counters := make(map[string]*counterState)
+	for key, c := range a.counters {
+		// the fraction of a counter idle for a whole interval is dropped
+		if c.idle {
+			continue
+		}
+		delta := int64(math.Round(c.delta))
+		// the fraction left by the sample rate is carried into the next
+		// interval, so that the sampled counter is right on average
+		if rest := c.delta - float64(delta); rest != 0 {
+			counters[key] = &counterState{series: c.series, delta: rest, idle: true}
+		}
+		if delta == 0 {
+			continue
+		}
+		metrics = append(metrics, domain.Metrics{ID: c.name, Labels: c.labels, MType: domain.Counter, Delta: &delta})
+	}
+	for _, g := range a.gauges {
+		value := g.value
+		m := domain.Metrics{ID: g.name, Labels: g.labels, MType: domain.Gauge, Value: &value}
+		if g.relative {
+			relative = append(relative, m)
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+	for _, t := range a.timers {
+		histogram := t.histogram
+		metrics = append(metrics, domain.Metrics{ID: t.name, Labels: t.labels, MType: domain.Histogram, Histogram: &histogram})
+	}
+	a.counters = counters
+	a.gauges = make(map[string]*gaugeState)
+	a.timers = make(map[string]*timerState)
+
+	return metrics, relative
+}
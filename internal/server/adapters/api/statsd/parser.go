@@ -0,0 +1,99 @@
+package api
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	counterType     = "c"
+	gaugeType       = "g"
+	timerType       = "ms"
+	histogramType   = "h"
+	sampleRatePart  = '@'
+	tagsPart        = '#'
+	nameValueSep    = ":"
+	partsSep        = "|"
+	tagsSep         = ","
+	tagNameValueSep = ":"
+)
+
+var (
+	ErrInvalidLine       = errors.New("invalid statsd line")
+	ErrInvalidMetricType = errors.New("invalid metric type")
+	ErrInvalidValue      = errors.New("invalid metric value")
+	ErrInvalidSampleRate = errors.New("invalid sample rate")
+)
+
+// sample is a single parsed StatsD line.
+type sample struct {
+	labels   map[string]string
+	name     string
+	mType    string
+	value    float64
+	rate     float64
+	relative bool
+}
+
+// parseLine parses name:value|type[|@rate][|#tag:value,...].
+// A gauge value with an explicit sign is a relative update.
+func parseLine(line string) (sample, error) {
+	name, rest, ok := strings.Cut(line, nameValueSep)
+	if !ok || name == "" {
+		return sample{}, errors.Wrap(ErrInvalidLine, line)
+	}
+	parts := strings.Split(rest, partsSep)
+	if len(parts) < 2 {
+		return sample{}, errors.Wrap(ErrInvalidLine, line)
+	}
+
+	s := sample{name: name, mType: parts[1], rate: 1}
+	switch s.mType {
+	case counterType, gaugeType, timerType, histogramType:
+	default:
+		return sample{}, errors.Wrap(ErrInvalidMetricType, line)
+	}
+
+	value, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return sample{}, errors.Wrap(ErrInvalidValue, line)
+	}
+	s.value = value
+	s.relative = s.mType == gaugeType && (parts[0][0] == '+' || parts[0][0] == '-')
+
+	for _, part := range parts[2:] {
+		if part == "" {
+			continue
+		}
+		switch part[0] {
+		case sampleRatePart:
+			rate, err := strconv.ParseFloat(part[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return sample{}, errors.Wrap(ErrInvalidSampleRate, line)
+			}
+			s.rate = rate
+		case tagsPart:
+			s.labels = parseTags(part[1:])
+		}
+	}
+
+	return s, nil
+}
+
+// parseTags parses the DogStatsD tags into labels, a tag without a value
+// becomes a label with an empty value.
+func parseTags(tags string) map[string]string {
+	labels := make(map[string]string)
+	for _, tag := range strings.Split(tags, tagsSep) {
+		name, value, _ := strings.Cut(tag, tagNameValueSep)
+		if name != "" {
+			labels[name] = value
+		}
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
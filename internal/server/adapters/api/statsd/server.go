@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/VoevodinAnton/metrics/internal/pkg/domain"
+	"github.com/VoevodinAnton/metrics/internal/server/config"
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+)
+
+const maxPacketSize = 65535
+
+type Service interface {
+	GetMetric(ctx context.Context, metric *domain.Metrics) (*domain.Metrics, error)
+	UpdatesMetrics(ctx context.Context, metrics *[]domain.Metrics) error
+}
+
+// Server receives StatsD lines over UDP and writes the aggregated metrics
+// to the service on every flush interval.
+type Server struct {
+	cfg     *config.Config
+	service Service
+	agg     *aggregator
+	conn    net.PacketConn
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+}
+
+func NewServer(cfg *config.Config, service Service) *Server {
+	return &Server{
+		cfg:     cfg,
+		service: service,
+		agg:     newAggregator(),
+		stop:    make(chan struct{}),
+	}
+}
+
+// ServeStatsD listens on cfg.StatsD.Address and blocks until Stop is called.
+func (s *Server) ServeStatsD() error {
+	conn, err := net.ListenPacket("udp", s.cfg.StatsD.Address)
+	if err != nil {
+		return errors.Wrap(err, "net.ListenPacket")
+	}
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.flushLoop()
+	}()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return errors.Wrap(err, "conn.ReadFrom")
+		}
+		s.handlePacket(string(buf[:n]))
+	}
+}
+
+func (s *Server) handlePacket(packet string) {
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		sample, err := parseLine(line)
+		if err != nil {
+			zap.L().Debug("statsd.parseLine", zap.Error(err))
+			continue
+		}
+		s.agg.add(sample)
+	}
+}
+
+func (s *Server) flushLoop() {
+	ticker := time.NewTicker(s.cfg.StatsD.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.flush(context.Background())
+		}
+	}
+}
+
+func (s *Server) flush(ctx context.Context) {
+	metrics, relative := s.agg.flush()
+	for _, change := range relative {
+		m, err := s.applyGaugeChange(ctx, change)
+		if err != nil {
+			zap.L().Error("statsd applyGaugeChange", zap.String("name", change.ID), zap.Error(err))
+			s.agg.restoreGaugeChange(change)
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+	if len(metrics) == 0 {
+		return
+	}
+	if err := s.service.UpdatesMetrics(ctx, &metrics); err != nil {
+		zap.L().Error("statsd service.UpdatesMetrics", zap.Error(err))
+	}
+}
+
+// applyGaugeChange adds the change of a gauge to its stored value, a gauge
+// the service does not have starts from 0. An update of the gauge received
+// by another API between the read and the write is overwritten.
+func (s *Server) applyGaugeChange(ctx context.Context, change domain.Metrics) (domain.Metrics, error) {
+	current, err := s.service.GetMetric(ctx, &domain.Metrics{ID: change.ID, MType: domain.Gauge, Labels: change.Labels})
+	if errors.Is(err, models.ErrMetricNotFound) {
+		return change, nil
+	}
+	if err != nil {
+		return change, errors.Wrap(err, "service.GetMetric")
+	}
+	if current.Value != nil {
+		value := *current.Value + *change.Value
+		change.Value = &value
+	}
+	return change, nil
+}
+
+// Shutdown closes the listener and writes the metrics aggregated so far.
+func (s *Server) Shutdown(ctx context.Context) {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+	if conn != nil {
+		if err := conn.Close(); err != nil {
+			zap.L().Error("statsd conn.Close", zap.Error(err))
+		}
+	}
+	close(s.stop)
+	s.wg.Wait()
+	s.flush(ctx)
+}
@@ -0,0 +1,259 @@
+package api
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VoevodinAnton/metrics/internal/pkg/domain"
+	"github.com/VoevodinAnton/metrics/internal/server/adapters/store/memory"
+	"github.com/VoevodinAnton/metrics/internal/server/config"
+	"github.com/VoevodinAnton/metrics/internal/server/core/service"
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		wantErr error
+		name    string
+		line    string
+		want    sample
+	}{
+		{
+			name: "counter",
+			line: "requests:3|c",
+			want: sample{name: "requests", mType: counterType, value: 3, rate: 1},
+		},
+		{
+			name: "counter with sample rate and tags",
+			line: "requests:1|c|@0.1|#host:a,canary",
+			want: sample{
+				name: "requests", mType: counterType, value: 1, rate: 0.1,
+				labels: map[string]string{"host": "a", "canary": ""},
+			},
+		},
+		{
+			name: "gauge",
+			line: "queue:42|g",
+			want: sample{name: "queue", mType: gaugeType, value: 42, rate: 1},
+		},
+		{
+			name: "relative gauge",
+			line: "queue:-5|g",
+			want: sample{name: "queue", mType: gaugeType, value: -5, rate: 1, relative: true},
+		},
+		{
+			name: "timer",
+			line: "latency:12.5|ms",
+			want: sample{name: "latency", mType: timerType, value: 12.5, rate: 1},
+		},
+		{name: "no value", line: "requests", wantErr: ErrInvalidLine},
+		{name: "no type", line: "requests:1", wantErr: ErrInvalidLine},
+		{name: "unknown type", line: "requests:1|s", wantErr: ErrInvalidMetricType},
+		{name: "invalid value", line: "requests:x|c", wantErr: ErrInvalidValue},
+		{name: "invalid sample rate", line: "requests:1|c|@2", wantErr: ErrInvalidSampleRate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLine(tt.line)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAggregator_flush(t *testing.T) {
+	a := newAggregator()
+	for _, line := range []string{
+		"requests:1|c", "requests:2|c|@0.5",
+		"queue:10|g", "queue:+5|g", "queue:-2|g",
+		"latency:7|ms", "latency:7|ms", "latency:20000|ms|@0.5",
+	} {
+		s, err := parseLine(line)
+		require.NoError(t, err)
+		a.add(s)
+	}
+
+	flushed, relative := a.flush()
+	assert.Empty(t, relative)
+	metrics := byID(flushed)
+	require.Len(t, metrics, 3)
+	assert.Equal(t, int64(5), *metrics["requests"].Delta)
+	assert.Equal(t, float64(13), *metrics["queue"].Value)
+	latency := metrics["latency"].Histogram
+	assert.Equal(t, uint64(4), latency.Count)
+	assert.Equal(t, float64(40014), latency.Sum)
+	assert.Equal(t, uint64(2), latency.Counts[1])
+	assert.Equal(t, uint64(2), latency.Counts[len(latency.Counts)-1])
+
+	// everything starts over, a relative update is flushed as the change
+	flushed, relative = a.flush()
+	assert.Empty(t, flushed)
+	assert.Empty(t, relative)
+	assert.Empty(t, a.gauges)
+	s, err := parseLine("queue:+1|g")
+	require.NoError(t, err)
+	a.add(s)
+	flushed, relative = a.flush()
+	assert.Empty(t, flushed)
+	assert.Equal(t, float64(1), *byID(relative)["queue"].Value)
+}
+
+func TestServer_flushRelativeGauges(t *testing.T) {
+	ctx := context.Background()
+	svc := service.New(memory.NewStorage())
+	labels := map[string]string{"host": "a"}
+	value := float64(10)
+	require.NoError(t, svc.UpdateMetric(ctx, &domain.Metrics{ID: "queue", MType: domain.Gauge, Labels: labels, Value: &value}))
+	s := NewServer(&config.Config{StatsD: &config.StatsD{FlushInterval: time.Hour}}, svc)
+
+	for _, line := range []string{"queue:+5|g|#host:a", "queue:-2|g|#host:a", "idle:+3|g"} {
+		sample, err := parseLine(line)
+		require.NoError(t, err)
+		s.agg.add(sample)
+	}
+	s.flush(ctx)
+
+	got, err := svc.GetMetric(ctx, &domain.Metrics{ID: "queue", MType: domain.Gauge, Labels: labels})
+	require.NoError(t, err)
+	assert.Equal(t, float64(13), *got.Value, "the change applies to the value set over another API")
+	got, err = svc.GetMetric(ctx, &domain.Metrics{ID: "idle", MType: domain.Gauge})
+	require.NoError(t, err)
+	assert.Equal(t, float64(3), *got.Value, "a new gauge starts from 0")
+}
+
+func TestAggregator_sampledCounters(t *testing.T) {
+	a := newAggregator()
+	sample, err := parseLine("requests:1|c|@0.3")
+	require.NoError(t, err)
+
+	// 3.33 per interval: the fractions add up to the total over three flushes
+	var total int64
+	for i := 0; i < 3; i++ {
+		a.add(sample)
+		flushed, _ := a.flush()
+		for _, m := range flushed {
+			total += *m.Delta
+		}
+	}
+	assert.Equal(t, int64(10), total)
+
+	// the fraction of an idle counter is dropped
+	a.add(sample)
+	_, _ = a.flush()
+	assert.NotEmpty(t, a.counters)
+	flushed, _ := a.flush()
+	assert.Empty(t, flushed)
+	assert.Empty(t, a.counters)
+}
+
+func TestServer_flushGaugeChangeError(t *testing.T) {
+	ctx := context.Background()
+	svc := &testService{getErr: errors.New("connection refused")}
+	s := NewServer(&config.Config{StatsD: &config.StatsD{FlushInterval: time.Hour}}, svc)
+	for _, line := range []string{"queue:+5|g", "idle:+1|g"} {
+		sample, err := parseLine(line)
+		require.NoError(t, err)
+		s.agg.add(sample)
+	}
+
+	// the change is kept until the stored value can be read
+	s.flush(ctx)
+	assert.Empty(t, svc.received())
+	sample, err := parseLine("queue:+1|g")
+	require.NoError(t, err)
+	s.agg.add(sample)
+	sample, err = parseLine("idle:4|g")
+	require.NoError(t, err)
+	s.agg.add(sample)
+
+	svc.getErr = nil
+	s.flush(ctx)
+	metrics := byID(svc.received())
+	assert.Equal(t, float64(6), *metrics["queue"].Value)
+	assert.Equal(t, float64(4), *metrics["idle"].Value, "a value set since replaces the change")
+}
+
+type testService struct {
+	// getErr is returned by GetMetric instead of a missing metric
+	getErr  error
+	metrics []domain.Metrics
+	mu      sync.Mutex
+}
+
+func (s *testService) GetMetric(_ context.Context, metric *domain.Metrics) (*domain.Metrics, error) {
+	if s.getErr != nil {
+		return nil, s.getErr
+	}
+	return nil, errors.Wrap(models.ErrMetricNotFound, metric.ID)
+}
+
+func (s *testService) UpdatesMetrics(_ context.Context, metrics *[]domain.Metrics) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = append(s.metrics, *metrics...)
+	return nil
+}
+
+func (s *testService) received() []domain.Metrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]domain.Metrics(nil), s.metrics...)
+}
+
+func TestServer_ServeStatsD(t *testing.T) {
+	addr := freeUDPAddress(t)
+	service := &testService{}
+	s := NewServer(&config.Config{StatsD: &config.StatsD{Address: addr, FlushInterval: time.Hour}}, service)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.ServeStatsD()
+	}()
+
+	conn, err := net.Dial("udp", addr)
+	require.NoError(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+	// the listener may not be bound yet, resend until the line is aggregated
+	require.Eventually(t, func() bool {
+		_, _ = conn.Write([]byte("requests:1|c\nqueue:3|g\n"))
+		s.agg.mu.Lock()
+		defer s.agg.mu.Unlock()
+		return len(s.agg.gauges) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	s.Shutdown(context.Background())
+	require.NoError(t, <-served)
+	metrics := byID(service.received())
+	assert.Equal(t, float64(3), *metrics["queue"].Value)
+	assert.Positive(t, *metrics["requests"].Delta)
+}
+
+func freeUDPAddress(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := conn.LocalAddr().String()
+	require.NoError(t, conn.Close())
+	return addr
+}
+
+func byID(metrics []domain.Metrics) map[string]domain.Metrics {
+	result := make(map[string]domain.Metrics, len(metrics))
+	for _, m := range metrics {
+		result[m.ID] = m
+	}
+	return result
+}
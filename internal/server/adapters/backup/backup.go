@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/VoevodinAnton/metrics/internal/server/config"
@@ -19,25 +20,82 @@ const (
 type Store interface {
 	PutCounterMetric(ctx context.Context, update models.Metric) error
 	PutGaugeMetric(ctx context.Context, update models.Metric) error
+	PutHistogramMetric(ctx context.Context, update models.Metric) error
 	GetCounterMetrics(ctx context.Context) (map[string]models.Metric, error)
 	GetGaugeMetrics(ctx context.Context) (map[string]models.Metric, error)
+	GetHistogramMetrics(ctx context.Context) (map[string]models.Metric, error)
+	DeleteMetrics(ctx context.Context, metrics []models.Metric) (int, error)
+	ResetCounterMetrics(ctx context.Context, metrics []models.Metric) (int, error)
 }
 
+// Durable is implemented by the stores that keep the metrics on disk
+// themselves. Restoring the backup into them would add the counters and
+// the histograms twice, so the backup is disabled for them.
+type Durable interface {
+	Durable() bool
+}
+
+// Backuper keeps the metrics in cfg.FilePath. With a positive
+// cfg.StoreInterval it snapshots the store periodically. A zero interval
+// selects the synchronous mode: every update is appended to a write-ahead
+// log next to the snapshot, and the log is compacted into the snapshot once
+// it grows long enough.
 type Backuper struct {
-	store Store
-	cfg   *config.Config
+	store   Store
+	cfg     *config.Config
+	wal     *os.File
+	compact chan struct{}
+	records int
+	// walSize is the length of the log up to the last complete record.
+	walSize int64
+	// seq is the sequence number of the last logged record. The snapshot
+	// stores it, so that the replay skips the records the snapshot has if
+	// the log was not emptied after it.
+	seq uint64
+	// mu is held for reading while an update is logged and applied, and for
+	// writing while the snapshot is taken, so that the snapshot has exactly
+	// the records up to seq.
+	mu    sync.RWMutex
+	walMu sync.Mutex
 }
 
 func New(cfg *config.Config, store Store) *Backuper {
 	return &Backuper{
-		store: store,
-		cfg:   cfg,
+		store:   store,
+		cfg:     cfg,
+		compact: make(chan struct{}, 1),
+	}
+}
+
+// Enabled reports whether the metrics are backed up to cfg.FilePath: a
+// file is set and the store does not keep the metrics itself.
+func (b *Backuper) Enabled() bool {
+	if d, ok := b.store.(Durable); ok && d.Durable() {
+		return false
 	}
+	return b.cfg.FilePath != ""
+}
+
+// Synchronous reports whether every update is persisted as it is applied.
+func (b *Backuper) Synchronous() bool {
+	return b.cfg.StoreInterval == 0
 }
 
+// Run saves the metrics every cfg.StoreInterval until ctx is done. In the
+// synchronous mode it compacts the write-ahead log instead.
 func (b *Backuper) Run(ctx context.Context) {
+	if b.Synchronous() {
+		b.runCompaction(ctx)
+		return
+	}
 	ticker := time.NewTicker(b.cfg.StoreInterval)
-	for range ticker.C {
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 		err := b.SaveMetricsToFile(ctx)
 		if err != nil {
 			zap.L().Error("saveMetricsToFile", zap.Error(err))
@@ -47,7 +105,28 @@ func (b *Backuper) Run(ctx context.Context) {
 	}
 }
 
+// SaveMetricsToFile writes the snapshot of the store and empties the
+// write-ahead log, if there is one.
 func (b *Backuper) SaveMetricsToFile(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.saveSnapshot(ctx); err != nil {
+		return err
+	}
+	if b.wal == nil {
+		return nil
+	}
+	if err := b.wal.Truncate(0); err != nil {
+		return errors.Wrap(err, "wal.Truncate")
+	}
+	b.records = 0
+	b.walSize = 0
+
+	return nil
+}
+
+func (b *Backuper) saveSnapshot(ctx context.Context) error {
 	metrics := make(map[string]models.Metric)
 	gaugeMetrics, err := b.store.GetGaugeMetrics(ctx)
 	if err != nil {
@@ -57,58 +136,111 @@ func (b *Backuper) SaveMetricsToFile(ctx context.Context) error {
 	if err != nil {
 		return errors.Wrap(err, "store.GetCounterMetrics")
 	}
+	histogramMetrics, err := b.store.GetHistogramMetrics(ctx)
+	if err != nil {
+		return errors.Wrap(err, "store.GetHistogramMetrics")
+	}
 	for k, v := range gaugeMetrics {
 		metrics[k] = v
 	}
 	for k, v := range counterMetrics {
 		metrics[k] = v
 	}
+	for k, v := range histogramMetrics {
+		metrics[k] = v
+	}
 
-	data, err := json.Marshal(metrics)
+	data, err := encodeSnapshot(metrics, b.seq)
 	if err != nil {
-		return errors.Wrap(err, "json.Marshal")
+		return err
 	}
 
-	err = os.WriteFile(b.cfg.FilePath, data, writeFilePerm)
+	return b.writeSnapshot(data, time.Now())
+}
+
+// RestoreMetricsFromFile loads the snapshot and replays the write-ahead log
+// written after it. It does nothing if the backup is not enabled.
+func (b *Backuper) RestoreMetricsFromFile(ctx context.Context) error {
+	if !b.Enabled() {
+		return nil
+	}
+	seq, err := b.restoreSnapshot(ctx)
 	if err != nil {
-		return errors.Wrap(err, "os.WriteFile")
+		return err
 	}
 
-	return nil
+	return b.replayWAL(ctx, seq)
 }
 
-func (b *Backuper) RestoreMetricsFromFile(ctx context.Context) error {
-	file, err := os.Open(b.cfg.FilePath)
+// restoreSnapshot loads the newest snapshot that is intact, starting with
+// cfg.FilePath and falling back to the rotated ones, and returns the
+// sequence number of its last log record.
+func (b *Backuper) restoreSnapshot(ctx context.Context) (uint64, error) {
+	paths, err := b.snapshotPaths()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		} else {
-			return errors.Wrap(err, "os.Open")
-		}
+		return 0, err
+	}
+	if len(paths) == 0 {
+		return 0, nil
 	}
-	defer func() {
-		err := file.Close()
-		if err != nil {
-			zap.L().Error("file.Close", zap.Error(err))
-		}
-	}()
 
-	metrics := make(map[string]models.Metric)
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&metrics); err != nil {
-		return errors.Wrap(err, "decoder.Decode")
+	var metrics map[string]models.Metric
+	var seq uint64
+	for i, path := range paths {
+		metrics, seq, err = readSnapshot(path)
+		if err == nil {
+			if i > 0 {
+				zap.L().Warn("restored from a previous snapshot, the updates after it are lost",
+					zap.String("path", path))
+			}
+			break
+		}
+		zap.L().Error("readSnapshot", zap.String("path", path), zap.Error(err))
+	}
+	if err != nil {
+		return 0, errors.Wrap(ErrNoValidSnapshot, b.cfg.FilePath)
 	}
 
 	for _, metric := range metrics {
-		if metric.Type == models.Counter {
-			v, _ := metric.Value.(float64)
-			metric.Value = int64(v)
-			_ = b.store.PutCounterMetric(ctx, metric)
-		}
-		if metric.Type == models.Gauge {
-			_ = b.store.PutGaugeMetric(ctx, metric)
+		b.putMetric(ctx, metric)
+	}
+	b.seq = seq
+
+	return seq, nil
+}
+
+// putMetric writes the decoded metric to the store: a counter adds its
+// value, a gauge replaces it and a histogram is merged.
+func (b *Backuper) putMetric(ctx context.Context, metric models.Metric) {
+	switch metric.Type {
+	case models.Counter:
+		v, _ := metric.Value.(float64)
+		metric.Value = int64(v)
+		_ = b.store.PutCounterMetric(ctx, metric)
+	case models.Gauge:
+		_ = b.store.PutGaugeMetric(ctx, metric)
+	case models.Histogram:
+		h, err := decodeHistogram(metric.Value)
+		if err != nil {
+			zap.L().Error("decodeHistogram", zap.String("metric", metric.Key()), zap.Error(err))
+			return
 		}
+		metric.Value = h
+		_ = b.store.PutHistogramMetric(ctx, metric)
 	}
+}
 
-	return nil
+// decodeHistogram converts the generic JSON object a histogram value is
+// decoded into back to models.HistogramValue.
+func decodeHistogram(value any) (models.HistogramValue, error) {
+	var h models.HistogramValue
+	data, err := json.Marshal(value)
+	if err != nil {
+		return h, errors.Wrap(err, "json.Marshal")
+	}
+	if err := json.Unmarshal(data, &h); err != nil {
+		return h, errors.Wrap(err, "json.Unmarshal")
+	}
+
+	return h, errors.Wrap(h.Validate(), "histogram.Validate")
 }
@@ -0,0 +1,73 @@
+package backup
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VoevodinAnton/metrics/internal/server/adapters/store/bolt"
+	"github.com/VoevodinAnton/metrics/internal/server/adapters/store/memory"
+	"github.com/VoevodinAnton/metrics/internal/server/adapters/store/wal"
+	"github.com/VoevodinAnton/metrics/internal/server/config"
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+)
+
+// durableStore is a store that keeps the metrics on disk.
+type durableStore interface {
+	Store
+	Durable
+	GetCounterMetric(ctx context.Context, name string, labels map[string]string) (models.Metric, error)
+	Close()
+}
+
+func TestBackuper_durableStoreRestart(t *testing.T) {
+	tests := []struct {
+		open func(cfg *config.Storage) (durableStore, error)
+		name string
+	}{
+		{
+			name: "wal",
+			open: func(cfg *config.Storage) (durableStore, error) { return wal.NewStore(cfg) },
+		},
+		{
+			name: "bolt",
+			open: func(cfg *config.Storage) (durableStore, error) { return bolt.NewStore(cfg) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			cfg := &config.Config{
+				FilePath: filepath.Join(dir, "metrics.json"),
+				Restore:  true,
+				Storage:  &config.Storage{Path: filepath.Join(dir, tt.name)},
+			}
+			counter := models.Metric{Name: "PollCount", Type: models.Counter, Value: int64(5)}
+
+			// the snapshot left by the default backup holds the same totals
+			snapshot := memory.NewStorage()
+			require.NoError(t, snapshot.PutCounterMetric(ctx, counter))
+			require.NoError(t, New(cfg, snapshot).SaveMetricsToFile(ctx))
+
+			s, err := tt.open(cfg.Storage)
+			require.NoError(t, err)
+			require.NoError(t, s.PutCounterMetric(ctx, counter))
+			assert.False(t, New(cfg, s).Enabled())
+			s.Close()
+
+			for i := 0; i < 2; i++ {
+				s, err = tt.open(cfg.Storage)
+				require.NoError(t, err)
+				require.NoError(t, New(cfg, s).RestoreMetricsFromFile(ctx))
+				got, err := s.GetCounterMetric(ctx, "PollCount", nil)
+				require.NoError(t, err)
+				assert.Equal(t, int64(5), got.Value, "restart %d", i+1)
+				s.Close()
+			}
+		})
+	}
+}
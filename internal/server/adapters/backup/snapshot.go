@@ -0,0 +1,220 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	snapshotVersion = 1
+	// rotationLayout is the timestamp suffix of the rotated snapshots, it
+	// sorts in time order.
+	rotationLayout = "20060102T150405.000000000Z"
+)
+
+var (
+	ErrNoValidSnapshot            = errors.New("no valid snapshot")
+	ErrSnapshotChecksum           = errors.New("snapshot checksum mismatch")
+	ErrUnsupportedSnapshotVersion = errors.New("unsupported snapshot version")
+)
+
+// snapshotHeader is the first line of a snapshot, the metrics follow it as
+// a JSON object keyed by the series. Seq is the sequence number of the last
+// write-ahead log record the snapshot includes.
+type snapshotHeader struct {
+	SHA256  string `json:"sha256"`
+	Version int    `json:"version"`
+	Seq     uint64 `json:"seq,omitempty"`
+}
+
+func encodeSnapshot(metrics map[string]models.Metric, seq uint64) ([]byte, error) {
+	body, err := json.Marshal(metrics)
+	if err != nil {
+		return nil, errors.Wrap(err, "json.Marshal")
+	}
+	sum := sha256.Sum256(body)
+	header, err := json.Marshal(snapshotHeader{Version: snapshotVersion, SHA256: hex.EncodeToString(sum[:]), Seq: seq})
+	if err != nil {
+		return nil, errors.Wrap(err, "json.Marshal")
+	}
+
+	data := make([]byte, 0, len(header)+1+len(body))
+	data = append(data, header...)
+	data = append(data, '\n')
+	return append(data, body...), nil
+}
+
+// decodeSnapshot verifies and decodes a snapshot and returns the sequence
+// number of its last log record. A file without the header is a snapshot
+// written before it was introduced and is read as is.
+func decodeSnapshot(data []byte) (map[string]models.Metric, uint64, error) {
+	metrics := make(map[string]models.Metric)
+
+	line, body, found := bytes.Cut(data, []byte{'\n'})
+	var header snapshotHeader
+	if !found || json.Unmarshal(line, &header) != nil || header.Version == 0 {
+		if err := json.Unmarshal(data, &metrics); err != nil {
+			return nil, 0, errors.Wrap(err, "json.Unmarshal")
+		}
+		return metrics, 0, nil
+	}
+	if header.Version != snapshotVersion {
+		return nil, 0, errors.Wrapf(ErrUnsupportedSnapshotVersion, "version %d", header.Version)
+	}
+	sum := sha256.Sum256(body)
+	if hex.EncodeToString(sum[:]) != header.SHA256 {
+		return nil, 0, ErrSnapshotChecksum
+	}
+	if err := json.Unmarshal(body, &metrics); err != nil {
+		return nil, 0, errors.Wrap(err, "json.Unmarshal")
+	}
+
+	return metrics, header.Seq, nil
+}
+
+func readSnapshot(path string) (map[string]models.Metric, uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "os.ReadFile")
+	}
+
+	return decodeSnapshot(data)
+}
+
+// writeSnapshot replaces cfg.FilePath with data so that a crash leaves
+// either the old or the new snapshot: data goes to a temporary file that is
+// synced and renamed over the old one. The old snapshot is kept under a
+// timestamped name if cfg.BackupKeep allows it.
+func (b *Backuper) writeSnapshot(data []byte, now time.Time) error {
+	dir := filepath.Dir(b.cfg.FilePath)
+	tmp, err := os.CreateTemp(dir, filepath.Base(b.cfg.FilePath)+".tmp*")
+	if err != nil {
+		return errors.Wrap(err, "os.CreateTemp")
+	}
+	if err := writeAndSync(tmp, data); err != nil {
+		if err := os.Remove(tmp.Name()); err != nil {
+			zap.L().Error("os.Remove", zap.Error(err))
+		}
+		return err
+	}
+
+	if b.cfg.BackupKeep > 0 {
+		err := os.Link(b.cfg.FilePath, b.cfg.FilePath+"."+now.UTC().Format(rotationLayout))
+		if err != nil && !os.IsNotExist(err) {
+			zap.L().Error("rotate snapshot", zap.Error(err))
+		}
+	}
+	if err := os.Rename(tmp.Name(), b.cfg.FilePath); err != nil {
+		return errors.Wrap(err, "os.Rename")
+	}
+	if err := syncDir(dir); err != nil {
+		return err
+	}
+
+	b.pruneSnapshots()
+	return nil
+}
+
+func writeAndSync(file *os.File, data []byte) error {
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return errors.Wrap(err, "file.Write")
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return errors.Wrap(err, "file.Sync")
+	}
+
+	return errors.Wrap(file.Close(), "file.Close")
+}
+
+// syncDir makes the rename durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return errors.Wrap(err, "os.Open")
+	}
+	defer func() {
+		if err := d.Close(); err != nil {
+			zap.L().Error("dir.Close", zap.Error(err))
+		}
+	}()
+
+	return errors.Wrap(d.Sync(), "dir.Sync")
+}
+
+// rotatedSnapshots returns the paths of the previous snapshots, the newest
+// first.
+func (b *Backuper) rotatedSnapshots() ([]string, error) {
+	dir := filepath.Dir(b.cfg.FilePath)
+	prefix := filepath.Base(b.cfg.FilePath) + "."
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "os.ReadDir")
+	}
+
+	var names []string
+	for _, e := range entries {
+		suffix, ok := strings.CutPrefix(e.Name(), prefix)
+		if !ok || e.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(rotationLayout, suffix); err != nil {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	paths := make([]string, 0, len(names))
+	for _, name := range names {
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	return paths, nil
+}
+
+// snapshotPaths returns the existing snapshots in the order they are tried
+// on restore.
+func (b *Backuper) snapshotPaths() ([]string, error) {
+	var paths []string
+	if _, err := os.Stat(b.cfg.FilePath); err == nil {
+		paths = append(paths, b.cfg.FilePath)
+	} else if !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "os.Stat")
+	}
+	rotated, err := b.rotatedSnapshots()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(paths, rotated...), nil
+}
+
+func (b *Backuper) pruneSnapshots() {
+	rotated, err := b.rotatedSnapshots()
+	if err != nil {
+		zap.L().Error("rotatedSnapshots", zap.Error(err))
+		return
+	}
+	for len(rotated) > b.cfg.BackupKeep {
+		last := rotated[len(rotated)-1]
+		if err := os.Remove(last); err != nil {
+			zap.L().Error("os.Remove", zap.Error(err))
+		}
+		rotated = rotated[:len(rotated)-1]
+	}
+}
@@ -0,0 +1,84 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VoevodinAnton/metrics/internal/server/adapters/store/memory"
+	"github.com/VoevodinAnton/metrics/internal/server/config"
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeSnapshot(t *testing.T) {
+	metrics := map[string]models.Metric{
+		"Alloc": {Name: "Alloc", Type: models.Gauge, Value: float64(1.5)},
+	}
+	data, err := encodeSnapshot(metrics, 7)
+	require.NoError(t, err)
+
+	tests := []struct {
+		wantErr error
+		name    string
+		data    []byte
+		wantSeq uint64
+	}{
+		{name: "valid", data: data, wantSeq: 7},
+		{name: "without header", data: []byte(`{"Alloc":{"Value":1.5,"Labels":null,"Name":"Alloc","Type":"gauge"}}`)},
+		{name: "corrupted", data: append(data[:len(data)-1:len(data)-1], ']'), wantErr: ErrSnapshotChecksum},
+		{
+			name:    "unknown version",
+			data:    []byte("{\"version\":2,\"sha256\":\"\"}\n{}"),
+			wantErr: ErrUnsupportedSnapshotVersion,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, seq, err := decodeSnapshot(tt.data)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, metrics, got)
+			assert.Equal(t, tt.wantSeq, seq)
+		})
+	}
+}
+
+func TestBackuper_SnapshotRotation(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		FilePath:      filepath.Join(t.TempDir(), "metrics.json"),
+		StoreInterval: time.Minute,
+		BackupKeep:    2,
+	}
+	store := memory.NewStorage()
+	b := New(cfg, store)
+
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, store.PutGaugeMetric(ctx, models.Metric{Name: "Alloc", Type: models.Gauge, Value: float64(i)}))
+		require.NoError(t, b.SaveMetricsToFile(ctx))
+	}
+	rotated, err := b.rotatedSnapshots()
+	require.NoError(t, err)
+	require.Len(t, rotated, cfg.BackupKeep)
+
+	// a damaged snapshot is skipped in favour of the newest rotated one
+	require.NoError(t, os.WriteFile(cfg.FilePath, []byte("{\"version\":1,\"sha256\":\"00\"}\n{}"), writeFilePerm))
+	restored := memory.NewStorage()
+	require.NoError(t, New(cfg, restored).RestoreMetricsFromFile(ctx))
+	gauge, err := restored.GetGaugeMetric(ctx, "Alloc", nil)
+	require.NoError(t, err)
+	assert.Equal(t, float64(3), gauge.Value)
+
+	for _, path := range rotated {
+		require.NoError(t, os.WriteFile(path, []byte("{"), writeFilePerm))
+	}
+	err = New(cfg, memory.NewStorage()).RestoreMetricsFromFile(ctx)
+	assert.ErrorIs(t, err, ErrNoValidSnapshot)
+}
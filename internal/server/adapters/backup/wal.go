@@ -0,0 +1,216 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	walSuffix = ".wal"
+	// walCompactRecords is the number of logged updates after which the
+	// log is folded into the snapshot.
+	walCompactRecords = 10000
+
+	walOpDelete = "delete"
+	walOpReset  = "reset"
+)
+
+// walRecord is a line of the log: an update, or with Op set the series
+// deleted or the counter reset. Seq numbers the records in the order they
+// are logged, a record without it was written before it was introduced.
+type walRecord struct {
+	models.Metric
+	Op  string `json:",omitempty"`
+	Seq uint64 `json:",omitempty"`
+}
+
+func (b *Backuper) walPath() string {
+	return b.cfg.FilePath + walSuffix
+}
+
+// OpenWAL starts the synchronous mode: it writes a snapshot of the store,
+// so that the log starts empty, and opens the log for the updates.
+func (b *Backuper) OpenWAL(ctx context.Context) error {
+	file, err := os.OpenFile(b.walPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, writeFilePerm)
+	if err != nil {
+		return errors.Wrap(err, "os.OpenFile")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return errors.Wrap(err, "file.Stat")
+	}
+	b.mu.Lock()
+	b.wal = file
+	b.walSize = info.Size()
+	b.mu.Unlock()
+
+	return b.SaveMetricsToFile(ctx)
+}
+
+// Write appends the updates to the log, syncs it and applies them with
+// apply. The records of updates that fail to apply are cut off the log, so
+// an acknowledged update survives a crash of the host and a rejected one is
+// not replayed. Every write waits for an fsync.
+func (b *Backuper) Write(ctx context.Context, updates []models.Metric, apply func() error) error {
+	return b.write("", updates, apply)
+}
+
+// Delete applies the deletion of the metrics with apply and logs it, so
+// that the replay does not bring the series back.
+func (b *Backuper) Delete(ctx context.Context, metrics []models.Metric, apply func() error) error {
+	return b.write(walOpDelete, metrics, apply)
+}
+
+// ResetCounters applies the reset of the counters with apply and logs it.
+func (b *Backuper) ResetCounters(ctx context.Context, metrics []models.Metric, apply func() error) error {
+	return b.write(walOpReset, metrics, apply)
+}
+
+func (b *Backuper) write(op string, metrics []models.Metric, apply func() error) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.wal == nil {
+		return apply()
+	}
+
+	// the records are logged and applied in the same order
+	b.walMu.Lock()
+	defer b.walMu.Unlock()
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	seq := b.seq
+	for _, metric := range metrics {
+		seq++
+		if err := encoder.Encode(walRecord{Metric: metric, Op: op, Seq: seq}); err != nil {
+			return errors.Wrap(err, "encoder.Encode")
+		}
+	}
+	if err := b.appendWAL(buf.Bytes()); err != nil {
+		return err
+	}
+	if err := apply(); err != nil {
+		b.walSize -= int64(buf.Len())
+		b.truncateWAL()
+		return err
+	}
+	b.seq = seq
+	b.records += len(metrics)
+	if b.records >= walCompactRecords {
+		select {
+		case b.compact <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// appendWAL writes the records and syncs them. A failed write is cut off,
+// so that the next records do not follow a torn one.
+func (b *Backuper) appendWAL(data []byte) error {
+	if _, err := b.wal.Write(data); err != nil {
+		b.truncateWAL()
+		return errors.Wrap(err, "wal.Write")
+	}
+	if err := b.wal.Sync(); err != nil {
+		b.truncateWAL()
+		return errors.Wrap(err, "wal.Sync")
+	}
+	b.walSize += int64(len(data))
+
+	return nil
+}
+
+// truncateWAL cuts off everything written after walSize.
+func (b *Backuper) truncateWAL() {
+	if err := b.wal.Truncate(b.walSize); err != nil {
+		zap.L().Error("wal.Truncate", zap.Error(err))
+	}
+}
+
+// Close closes the log. It does not compact it, call SaveMetricsToFile
+// before to leave a single snapshot behind.
+func (b *Backuper) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.wal == nil {
+		return nil
+	}
+	err := b.wal.Close()
+	b.wal = nil
+
+	return errors.Wrap(err, "wal.Close")
+}
+
+func (b *Backuper) runCompaction(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.compact:
+		}
+		if err := b.SaveMetricsToFile(ctx); err != nil {
+			zap.L().Error("saveMetricsToFile", zap.Error(err))
+			continue
+		}
+		zap.L().Sugar().Infof("write-ahead log compacted into %s", b.cfg.FilePath)
+	}
+}
+
+// replayWAL applies the logged operations on top of the restored snapshot,
+// skipping the records up to seq that the snapshot already has. A record
+// torn by a crash ends the log: its update was never acknowledged.
+func (b *Backuper) replayWAL(ctx context.Context, seq uint64) error {
+	file, err := os.Open(b.walPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "os.Open")
+	}
+	defer func() {
+		err := file.Close()
+		if err != nil {
+			zap.L().Error("file.Close", zap.Error(err))
+		}
+	}()
+
+	decoder := json.NewDecoder(file)
+	for decoder.More() {
+		var record walRecord
+		if err := decoder.Decode(&record); err != nil {
+			zap.L().Warn("write-ahead log ends with a torn record", zap.Error(err))
+			break
+		}
+		if record.Seq != 0 && record.Seq <= seq {
+			continue
+		}
+		if record.Seq > b.seq {
+			b.seq = record.Seq
+		}
+		series := []models.Metric{record.Metric}
+		var err error
+		switch record.Op {
+		case walOpDelete:
+			_, err = b.store.DeleteMetrics(ctx, series)
+		case walOpReset:
+			_, err = b.store.ResetCounterMetrics(ctx, series)
+		default:
+			b.putMetric(ctx, record.Metric)
+		}
+		if err != nil {
+			zap.L().Error("replayWAL", zap.String("op", record.Op), zap.String("metric", record.Key()), zap.Error(err))
+		}
+	}
+
+	return nil
+}
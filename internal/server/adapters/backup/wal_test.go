@@ -0,0 +1,172 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/VoevodinAnton/metrics/internal/server/adapters/store/memory"
+	"github.com/VoevodinAnton/metrics/internal/server/config"
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackuper_WAL(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{FilePath: filepath.Join(t.TempDir(), "metrics.json")}
+
+	store := memory.NewStorage()
+	b := New(cfg, store)
+	require.True(t, b.Synchronous())
+	require.NoError(t, b.OpenWAL(ctx))
+
+	put := func(m models.Metric) {
+		t.Helper()
+		err := b.Write(ctx, []models.Metric{m}, func() error {
+			if m.Type == models.Counter {
+				return store.PutCounterMetric(ctx, m)
+			}
+			return store.PutGaugeMetric(ctx, m)
+		})
+		require.NoError(t, err)
+	}
+
+	put(models.Metric{Name: "PollCount", Type: models.Counter, Value: int64(2)})
+	put(models.Metric{Name: "Alloc", Type: models.Gauge, Value: float64(1.5)})
+	// the snapshot holds the first updates, the log the later ones
+	require.NoError(t, b.SaveMetricsToFile(ctx))
+	put(models.Metric{Name: "PollCount", Type: models.Counter, Value: int64(3)})
+	put(models.Metric{Name: "Alloc", Type: models.Gauge, Value: float64(7)})
+	require.NoError(t, b.Close())
+
+	// a crash in the middle of a write leaves a torn record behind
+	wal, err := os.OpenFile(cfg.FilePath+walSuffix, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = wal.WriteString(`{"Name":"PollCount","Type":"coun`)
+	require.NoError(t, err)
+	require.NoError(t, wal.Close())
+
+	restored := memory.NewStorage()
+	require.NoError(t, New(cfg, restored).RestoreMetricsFromFile(ctx))
+
+	counter, err := restored.GetCounterMetric(ctx, "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counter.Value)
+	gauge, err := restored.GetGaugeMetric(ctx, "Alloc", nil)
+	require.NoError(t, err)
+	assert.Equal(t, float64(7), gauge.Value)
+}
+
+func TestBackuper_WALDeleteAndReset(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{FilePath: filepath.Join(t.TempDir(), "metrics.json")}
+
+	store := memory.NewStorage()
+	require.NoError(t, store.PutCounterMetric(ctx, models.Metric{Name: "PollCount", Type: models.Counter, Value: int64(2)}))
+	require.NoError(t, store.PutGaugeMetric(ctx, models.Metric{Name: "Alloc", Type: models.Gauge, Value: float64(1)}))
+	b := New(cfg, store)
+	require.NoError(t, b.OpenWAL(ctx))
+
+	// the snapshot has both series, the log removes one and resets the other
+	series := []models.Metric{{Name: "Alloc", Type: models.Gauge}}
+	require.NoError(t, b.Delete(ctx, series, func() error {
+		_, err := store.DeleteMetrics(ctx, series)
+		return err
+	}))
+	counters := []models.Metric{{Name: "PollCount", Type: models.Counter}}
+	require.NoError(t, b.ResetCounters(ctx, counters, func() error {
+		_, err := store.ResetCounterMetrics(ctx, counters)
+		return err
+	}))
+	require.NoError(t, b.Close())
+
+	restored := memory.NewStorage()
+	require.NoError(t, New(cfg, restored).RestoreMetricsFromFile(ctx))
+
+	_, err := restored.GetGaugeMetric(ctx, "Alloc", nil)
+	assert.ErrorIs(t, err, memory.ErrMetricNotFound)
+	counter, err := restored.GetCounterMetric(ctx, "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), counter.Value)
+}
+
+func TestBackuper_WriteFailedApply(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{FilePath: filepath.Join(t.TempDir(), "metrics.json")}
+	b := New(cfg, memory.NewStorage())
+	require.NoError(t, b.OpenWAL(ctx))
+	defer func() {
+		require.NoError(t, b.Close())
+	}()
+
+	errApply := assert.AnError
+	err := b.Write(ctx, []models.Metric{{Name: "Alloc", Type: models.Gauge, Value: float64(1)}}, func() error {
+		return errApply
+	})
+	require.ErrorIs(t, err, errApply)
+
+	info, err := os.Stat(cfg.FilePath + walSuffix)
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+}
+
+func TestBackuper_crashBeforeWALTruncate(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{FilePath: filepath.Join(t.TempDir(), "metrics.json")}
+	store := memory.NewStorage()
+	b := New(cfg, store)
+	require.NoError(t, b.OpenWAL(ctx))
+
+	put := func(m models.Metric) {
+		t.Helper()
+		require.NoError(t, b.Write(ctx, []models.Metric{m}, func() error {
+			return store.PutCounterMetric(ctx, m)
+		}))
+	}
+	put(models.Metric{Name: "PollCount", Type: models.Counter, Value: int64(2)})
+	put(models.Metric{Name: "PollCount", Type: models.Counter, Value: int64(3)})
+	// the snapshot is renamed into place, the process dies before the log
+	// is emptied
+	b.mu.Lock()
+	require.NoError(t, b.saveSnapshot(ctx))
+	b.mu.Unlock()
+	require.NoError(t, b.Close())
+
+	restored := memory.NewStorage()
+	b = New(cfg, restored)
+	require.NoError(t, b.RestoreMetricsFromFile(ctx))
+	counter, err := restored.GetCounterMetric(ctx, "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counter.Value)
+
+	// the numbering goes on after the restored records
+	require.NoError(t, b.OpenWAL(ctx))
+	require.NoError(t, b.Write(ctx, []models.Metric{{Name: "PollCount", Type: models.Counter, Value: int64(1)}}, func() error {
+		return restored.PutCounterMetric(ctx, models.Metric{Name: "PollCount", Type: models.Counter, Value: int64(1)})
+	}))
+	require.NoError(t, b.Close())
+
+	restored = memory.NewStorage()
+	require.NoError(t, New(cfg, restored).RestoreMetricsFromFile(ctx))
+	counter, err = restored.GetCounterMetric(ctx, "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), counter.Value)
+}
+
+func TestBackuper_WriteFailedLog(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{FilePath: filepath.Join(t.TempDir(), "metrics.json")}
+	b := New(cfg, memory.NewStorage())
+	require.NoError(t, b.OpenWAL(ctx))
+	require.NoError(t, b.wal.Close())
+
+	applied := false
+	err := b.Write(ctx, []models.Metric{{Name: "Alloc", Type: models.Gauge, Value: float64(1)}}, func() error {
+		applied = true
+		return nil
+	})
+	assert.Error(t, err)
+	assert.False(t, applied, "an update that is not logged is not applied")
+}
@@ -1,25 +1,54 @@
 package middlewares
 
 import (
+	"bytes"
 	"compress/gzip"
+	"crypto/rsa"
 	"io"
 	"net/http"
 	"strings"
 
 	"github.com/VoevodinAnton/metrics/internal/pkg/constants"
+	"github.com/VoevodinAnton/metrics/internal/server/config"
+	"github.com/VoevodinAnton/metrics/pkg/encryption"
+	"github.com/VoevodinAnton/metrics/pkg/hash"
 	"github.com/pkg/errors"
 )
 
+var (
+	ErrInvalidSignature      = errors.New("invalid signature")
+	ErrUnsupportedEncryption = errors.New("unsupported encryption")
+)
+
 type MiddlewareManager interface {
 	GzipCompressHandle(next http.Handler) http.Handler
 	GzipDecompressHandle(next http.Handler) http.Handler
+	HashHandle(next http.Handler) http.Handler
+	DecryptHandle(next http.Handler) http.Handler
 }
 
+type Option func(*middlewareManager)
+
 type middlewareManager struct {
+	cfg        *config.Config
+	privateKey *rsa.PrivateKey
 }
 
-func NewMiddlewareManager() *middlewareManager {
-	return &middlewareManager{}
+func NewMiddlewareManager(cfg *config.Config, opts ...Option) *middlewareManager {
+	mw := &middlewareManager{
+		cfg: cfg,
+	}
+	for _, opt := range opts {
+		opt(mw)
+	}
+	return mw
+}
+
+// WithPrivateKey sets the key DecryptHandle uses to decrypt request bodies.
+func WithPrivateKey(key *rsa.PrivateKey) Option {
+	return func(mw *middlewareManager) {
+		mw.privateKey = key
+	}
 }
 
 func (mw *middlewareManager) GzipCompressHandle(next http.Handler) http.Handler {
@@ -75,6 +104,85 @@ func (mw *middlewareManager) GzipDecompressHandle(next http.Handler) http.Handle
 	})
 }
 
+// HashHandle verifies the HMAC-SHA256 signature of the request body sent in
+// the HashSHA256 header and signs the response body the same way.
+// It does nothing if no key is configured.
+func (mw *middlewareManager) HashHandle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if mw.cfg.Key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := []byte(mw.cfg.Key)
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, http.DefaultMaxHeaderBytes))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !hash.Verify(key, body, r.Header.Get(constants.HashSHA256Header)) {
+			http.Error(w, ErrInvalidSignature.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		hw := &hashWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(hw, r)
+
+		w.Header().Set(constants.HashSHA256Header, hash.Sign(key, hw.body.Bytes()))
+		w.WriteHeader(hw.status)
+		_, _ = w.Write(hw.body.Bytes())
+	})
+}
+
+// DecryptHandle decrypts request bodies that the agent encrypted with the
+// server public key. Requests without the Encryption header pass unchanged.
+func (mw *middlewareManager) DecryptHandle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme := r.Header.Get(constants.EncryptionHeader)
+		if scheme == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if scheme != constants.EncryptionRSAAESGCM || mw.privateKey == nil {
+			http.Error(w, ErrUnsupportedEncryption.Error(), http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, http.DefaultMaxHeaderBytes))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		plain, err := encryption.Decrypt(mw.privateKey, body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(plain))
+		r.Header.Del(constants.EncryptionHeader)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hashWriter buffers the response so that its signature can be sent
+// in a header before the body.
+type hashWriter struct {
+	http.ResponseWriter
+	body   bytes.Buffer
+	status int
+}
+
+func (w *hashWriter) WriteHeader(statusCode int) {
+	w.status = statusCode
+}
+
+func (w *hashWriter) Write(b []byte) (int, error) {
+	n, err := w.body.Write(b)
+	return n, errors.Wrap(err, "body.Write")
+}
+
 type gzipWriter struct {
 	http.ResponseWriter
 	Writer io.Writer
@@ -0,0 +1,148 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VoevodinAnton/metrics/internal/pkg/constants"
+	"github.com/VoevodinAnton/metrics/internal/server/config"
+	"github.com/VoevodinAnton/metrics/pkg/encryption"
+	"github.com/VoevodinAnton/metrics/pkg/hash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareManager_HashHandle(t *testing.T) {
+	const (
+		key      = "secret"
+		body     = `{"id":"Alloc","type":"gauge","value":1}`
+		response = `{"id":"Alloc","type":"gauge","value":1}`
+	)
+	tests := []struct {
+		name       string
+		key        string
+		signature  string
+		wantStatus int
+		wantSigned bool
+	}{
+		{
+			name:       "valid signature",
+			key:        key,
+			signature:  hash.Sign([]byte(key), []byte(body)),
+			wantStatus: http.StatusOK,
+			wantSigned: true,
+		},
+		{
+			name:       "invalid signature",
+			key:        key,
+			signature:  hash.Sign([]byte("other"), []byte(body)),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "missing signature",
+			key:        key,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "no key configured",
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := NewMiddlewareManager(&config.Config{Key: tt.key})
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				assert.Equal(t, body, string(got))
+				w.WriteHeader(http.StatusOK)
+				_, _ = io.WriteString(w, response)
+			})
+
+			r := httptest.NewRequest(http.MethodPost, "/update", strings.NewReader(body))
+			if tt.signature != "" {
+				r.Header.Set(constants.HashSHA256Header, tt.signature)
+			}
+			w := httptest.NewRecorder()
+			mw.HashHandle(next).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantSigned {
+				assert.Equal(t, response, w.Body.String())
+				assert.True(t, hash.Verify([]byte(key), w.Body.Bytes(), w.Header().Get(constants.HashSHA256Header)))
+			}
+		})
+	}
+}
+
+func TestMiddlewareManager_DecryptHandle(t *testing.T) {
+	const body = `[{"id":"Alloc","type":"gauge","value":1}]`
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	encrypted, err := encryption.Encrypt(&key.PublicKey, []byte(body))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		key        *rsa.PrivateKey
+		body       []byte
+		encryption string
+		wantStatus int
+	}{
+		{
+			name:       "encrypted body",
+			key:        key,
+			body:       encrypted,
+			encryption: constants.EncryptionRSAAESGCM,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "plaintext body",
+			key:        key,
+			body:       []byte(body),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "encrypted body without private key",
+			body:       encrypted,
+			encryption: constants.EncryptionRSAAESGCM,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "corrupted body",
+			key:        key,
+			body:       encrypted[:len(encrypted)-1],
+			encryption: constants.EncryptionRSAAESGCM,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []Option
+			if tt.key != nil {
+				opts = append(opts, WithPrivateKey(tt.key))
+			}
+			mw := NewMiddlewareManager(&config.Config{}, opts...)
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				assert.Equal(t, body, string(got))
+			})
+
+			r := httptest.NewRequest(http.MethodPost, "/updates", bytes.NewReader(tt.body))
+			if tt.encryption != "" {
+				r.Header.Set(constants.EncryptionHeader, tt.encryption)
+			}
+			w := httptest.NewRecorder()
+			mw.DecryptHandle(next).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package retention
+
+import (
+	"context"
+	"time"
+
+	"github.com/VoevodinAnton/metrics/internal/server/config"
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	compactedRowsMetric = "RetentionCompactedRows"
+
+	jobLabel        = "job"
+	typeLabel       = "type"
+	resolutionLabel = "resolution"
+	jobName         = "retention"
+)
+
+type Store interface {
+	Compact(ctx context.Context, policy models.RetentionPolicy, now time.Time) (models.CompactionStats, error)
+	PutCounterMetrics(ctx context.Context, updates []models.Metric) error
+}
+
+type Retention struct {
+	store Store
+	cfg   *config.Config
+}
+
+func New(cfg *config.Config, store Store) *Retention {
+	return &Retention{
+		store: store,
+		cfg:   cfg,
+	}
+}
+
+// Run applies the retention policy every cfg.Retention.Interval until ctx is done.
+func (r *Retention) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.Retention.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := r.Compact(ctx)
+		if err != nil {
+			zap.L().Error("retention.Compact", zap.Error(err))
+			continue
+		}
+	}
+}
+
+// Compact applies the retention policy once and records the number of
+// compacted rows as counter metrics labeled with the source resolution.
+func (r *Retention) Compact(ctx context.Context) error {
+	stats, err := r.store.Compact(ctx, r.policy(), time.Now())
+	if err != nil {
+		return errors.Wrap(err, "store.Compact")
+	}
+	zap.L().Info("retention compacted", zap.Reflect("stats", stats))
+
+	err = r.store.PutCounterMetrics(ctx, []models.Metric{
+		compactedRows(models.Gauge, "raw", stats.GaugeRawRows),
+		compactedRows(models.Counter, "raw", stats.CounterRawRows),
+		compactedRows(models.Gauge, "1m", stats.GaugeMinuteRows),
+		compactedRows(models.Counter, "1m", stats.CounterMinuteRows),
+		compactedRows(models.Gauge, "1h", stats.GaugeHourRows),
+		compactedRows(models.Counter, "1h", stats.CounterHourRows),
+	})
+
+	return errors.Wrap(err, "store.PutCounterMetrics")
+}
+
+func (r *Retention) policy() models.RetentionPolicy {
+	return models.RetentionPolicy{
+		Raw:    r.cfg.Retention.Raw,
+		Minute: r.cfg.Retention.Minute,
+		Hour:   r.cfg.Retention.Hour,
+	}
+}
+
+func compactedRows(metricType, resolution string, rows int64) models.Metric {
+	return models.Metric{
+		Name: compactedRowsMetric,
+		Type: models.Counter,
+		Labels: map[string]string{
+			jobLabel:        jobName,
+			typeLabel:       metricType,
+			resolutionLabel: resolution,
+		},
+		Value: rows,
+	}
+}
@@ -0,0 +1,75 @@
+package retention
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/VoevodinAnton/metrics/internal/server/config"
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type TestStore struct {
+	policy  models.RetentionPolicy
+	stats   models.CompactionStats
+	updates []models.Metric
+}
+
+func (s *TestStore) Compact(
+	_ context.Context, policy models.RetentionPolicy, _ time.Time,
+) (models.CompactionStats, error) {
+	s.policy = policy
+	return s.stats, nil
+}
+
+func (s *TestStore) PutCounterMetrics(_ context.Context, updates []models.Metric) error {
+	s.updates = append(s.updates, updates...)
+	return nil
+}
+
+func TestRetention_Compact(t *testing.T) {
+	cfg := &config.Config{
+		Retention: &config.Retention{
+			Interval: time.Minute,
+			Raw:      time.Hour,
+			Minute:   24 * time.Hour,
+			Hour:     30 * 24 * time.Hour,
+		},
+	}
+	store := &TestStore{
+		stats: models.CompactionStats{
+			GaugeRawRows:   10,
+			CounterRawRows: 5,
+			GaugeHourRows:  1,
+		},
+	}
+
+	err := New(cfg, store).Compact(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, models.RetentionPolicy{
+		Raw:    time.Hour,
+		Minute: 24 * time.Hour,
+		Hour:   30 * 24 * time.Hour,
+	}, store.policy)
+
+	compacted := make(map[string]int64)
+	for _, m := range store.updates {
+		assert.Equal(t, compactedRowsMetric, m.Name)
+		assert.Equal(t, models.Counter, m.Type)
+		v, _ := m.Value.(int64)
+		compacted[m.Key()] = v
+	}
+	assert.Len(t, compacted, 6)
+	assert.Equal(t, int64(10), compacted[models.SeriesKey(compactedRowsMetric, map[string]string{
+		jobLabel: jobName, typeLabel: models.Gauge, resolutionLabel: "raw",
+	})])
+	assert.Equal(t, int64(5), compacted[models.SeriesKey(compactedRowsMetric, map[string]string{
+		jobLabel: jobName, typeLabel: models.Counter, resolutionLabel: "raw",
+	})])
+	assert.Equal(t, int64(1), compacted[models.SeriesKey(compactedRowsMetric, map[string]string{
+		jobLabel: jobName, typeLabel: models.Gauge, resolutionLabel: "1h",
+	})])
+}
@@ -0,0 +1,84 @@
+package bolt
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+)
+
+// record is the value stored under the series key, it keeps the name and
+// the labels to rebuild the metric.
+type record[T any] struct {
+	Labels map[string]string `json:"labels,omitempty"`
+	Name   string            `json:"name"`
+	Value  T                 `json:"value"`
+}
+
+// float is a float64 stored as its IEEE 754 bits in a hex JSON string: JSON
+// numbers have no NaN and infinities, which are valid gauge values. A plain
+// number written before is read as is.
+type float float64
+
+func (f float) MarshalJSON() ([]byte, error) {
+	return strconv.AppendQuote(nil, strconv.FormatUint(math.Float64bits(float64(f)), 16)), nil
+}
+
+func (f *float) UnmarshalJSON(data []byte) error {
+	if len(data) == 0 || data[0] != '"' {
+		var v float64
+		if err := json.Unmarshal(data, &v); err != nil {
+			return errors.Wrap(err, "json.Unmarshal")
+		}
+		*f = float(v)
+		return nil
+	}
+	s, err := strconv.Unquote(string(data))
+	if err != nil {
+		return errors.Wrap(err, "strconv.Unquote")
+	}
+	bits, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return errors.Wrap(err, "strconv.ParseUint")
+	}
+	*f = float(math.Float64frombits(bits))
+	return nil
+}
+
+// histogram is the stored models.HistogramValue, with the floats as bits.
+type histogram struct {
+	Buckets []float
+	Counts  []uint64
+	Sum     float
+	Count   uint64
+}
+
+func newHistogram(h models.HistogramValue) histogram {
+	buckets := make([]float, len(h.Buckets))
+	for i, b := range h.Buckets {
+		buckets[i] = float(b)
+	}
+	return histogram{Buckets: buckets, Counts: h.Counts, Sum: float(h.Sum), Count: h.Count}
+}
+
+func (h histogram) value() models.HistogramValue {
+	buckets := make([]float64, len(h.Buckets))
+	for i, b := range h.Buckets {
+		buckets[i] = float64(b)
+	}
+	return models.HistogramValue{Buckets: buckets, Counts: h.Counts, Sum: float64(h.Sum), Count: h.Count}
+}
+
+// metricValue converts a stored value to the value of models.Metric.
+func metricValue(v any) any {
+	switch v := v.(type) {
+	case float:
+		return float64(v)
+	case histogram:
+		return v.value()
+	}
+	return v
+}
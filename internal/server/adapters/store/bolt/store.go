@@ -0,0 +1,306 @@
+package bolt
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	bbolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+
+	"github.com/VoevodinAnton/metrics/internal/server/config"
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+)
+
+const (
+	dbFile      = "metrics.db"
+	filePerm    = 0600
+	dirPerm     = 0700
+	openTimeout = time.Second
+)
+
+var (
+	ErrMetricNotFound = models.ErrMetricNotFound
+
+	counterBucket   = []byte(models.Counter)
+	gaugeBucket     = []byte(models.Gauge)
+	histogramBucket = []byte(models.Histogram)
+)
+
+// Store keeps the metrics in a bbolt database, one bucket per metric type
+// keyed by the series. A batch is written in a single transaction.
+type Store struct {
+	db *bbolt.DB
+}
+
+func NewStore(cfg *config.Storage) (*Store, error) {
+	if err := os.MkdirAll(cfg.Path, dirPerm); err != nil {
+		return nil, errors.Wrap(err, "os.MkdirAll")
+	}
+	db, err := bbolt.Open(filepath.Join(cfg.Path, dbFile), filePerm, &bbolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, errors.Wrap(err, "bbolt.Open")
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{counterBucket, gaugeBucket, histogramBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return errors.Wrap(err, "tx.CreateBucketIfNotExists")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (s *Store) GetGaugeMetric(ctx context.Context, name string, labels map[string]string) (models.Metric, error) {
+	return getMetric[float](s.db, gaugeBucket, models.Gauge, name, labels)
+}
+
+func (s *Store) GetCounterMetric(ctx context.Context, name string, labels map[string]string) (models.Metric, error) {
+	return getMetric[int64](s.db, counterBucket, models.Counter, name, labels)
+}
+
+func (s *Store) GetHistogramMetric(ctx context.Context, name string, labels map[string]string) (models.Metric, error) {
+	return getMetric[histogram](s.db, histogramBucket, models.Histogram, name, labels)
+}
+
+func (s *Store) GetGaugeMetrics(ctx context.Context) (map[string]models.Metric, error) {
+	return getMetrics[float](s.db, gaugeBucket, models.Gauge)
+}
+
+func (s *Store) GetCounterMetrics(ctx context.Context) (map[string]models.Metric, error) {
+	return getMetrics[int64](s.db, counterBucket, models.Counter)
+}
+
+func (s *Store) GetHistogramMetrics(ctx context.Context) (map[string]models.Metric, error) {
+	return getMetrics[histogram](s.db, histogramBucket, models.Histogram)
+}
+
+func (s *Store) PutCounterMetric(ctx context.Context, update models.Metric) error {
+	return s.PutCounterMetrics(ctx, []models.Metric{update})
+}
+
+// PutCounterMetrics adds the deltas to the stored values.
+func (s *Store) PutCounterMetrics(ctx context.Context, updates []models.Metric) error {
+	return putMetrics(s.db, counterBucket, updates, func(current *int64, update models.Metric) (int64, error) {
+		delta, ok := update.Value.(int64)
+		if !ok {
+			return 0, errors.New("expected int64 type")
+		}
+		if current == nil {
+			return delta, nil
+		}
+		return *current + delta, nil
+	})
+}
+
+func (s *Store) PutGaugeMetric(ctx context.Context, update models.Metric) error {
+	return s.PutGaugeMetrics(ctx, []models.Metric{update})
+}
+
+func (s *Store) PutGaugeMetrics(ctx context.Context, updates []models.Metric) error {
+	return putMetrics(s.db, gaugeBucket, updates, func(_ *float, update models.Metric) (float, error) {
+		value, ok := update.Value.(float64)
+		if !ok {
+			return 0, errors.New("expected float64 type")
+		}
+		return float(value), nil
+	})
+}
+
+func (s *Store) PutHistogramMetric(ctx context.Context, update models.Metric) error {
+	return s.PutHistogramMetrics(ctx, []models.Metric{update})
+}
+
+// PutHistogramMetrics merges the updates into the stored histograms, a
+// bucket mismatch rolls the whole batch back.
+func (s *Store) PutHistogramMetrics(ctx context.Context, updates []models.Metric) error {
+	return putMetrics(s.db, histogramBucket, updates,
+		func(current *histogram, update models.Metric) (histogram, error) {
+			h, ok := update.Value.(models.HistogramValue)
+			if !ok {
+				return histogram{}, errors.New("expected histogram type")
+			}
+			if current == nil {
+				return newHistogram(h), nil
+			}
+			merged, err := current.value().Merge(h)
+			return newHistogram(merged), errors.Wrap(err, update.Key())
+		})
+}
+
+// DeleteMetrics removes the series of the metrics in one transaction and
+// returns the number of series that existed.
+func (s *Store) DeleteMetrics(ctx context.Context, metrics []models.Metric) (int, error) {
+	var deleted int
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		for _, metric := range metrics {
+			b := tx.Bucket([]byte(metric.Type))
+			if b == nil {
+				continue
+			}
+			key := []byte(metric.Key())
+			if b.Get(key) == nil {
+				continue
+			}
+			if err := b.Delete(key); err != nil {
+				return errors.Wrap(err, "bucket.Delete")
+			}
+			deleted++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "db.Update")
+	}
+
+	return deleted, nil
+}
+
+// ResetCounterMetrics sets the existing counters of the metrics to zero in
+// one transaction and returns the number of counters reset.
+func (s *Store) ResetCounterMetrics(ctx context.Context, metrics []models.Metric) (int, error) {
+	var reset int
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(counterBucket)
+		for _, metric := range metrics {
+			key := []byte(metric.Key())
+			data := b.Get(key)
+			if data == nil {
+				continue
+			}
+			var r record[int64]
+			if err := json.Unmarshal(data, &r); err != nil {
+				return errors.Wrap(err, "json.Unmarshal")
+			}
+			r.Value = 0
+			data, err := json.Marshal(r)
+			if err != nil {
+				return errors.Wrap(err, "json.Marshal")
+			}
+			if err := b.Put(key, data); err != nil {
+				return errors.Wrap(err, "bucket.Put")
+			}
+			reset++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "db.Update")
+	}
+
+	return reset, nil
+}
+
+func (s *Store) GetGaugeHistory(ctx context.Context, query models.HistoryQuery) ([]models.HistoryPoint, error) {
+	return nil, models.ErrHistoryNotSupported
+}
+
+func (s *Store) GetCounterHistory(ctx context.Context, query models.HistoryQuery) ([]models.HistoryPoint, error) {
+	return nil, models.ErrHistoryNotSupported
+}
+
+// Durable reports that the metrics are kept in the database file.
+func (s *Store) Durable() bool {
+	return true
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	return errors.Wrap(s.db.View(func(*bbolt.Tx) error { return nil }), "db.View")
+}
+
+func (s *Store) Close() {
+	if err := s.db.Close(); err != nil {
+		zap.L().Error("db.Close", zap.Error(err))
+	}
+}
+
+// putMetrics applies the updates in one transaction. merge receives the
+// stored value, nil if there is none, and returns the one to store.
+func putMetrics[T any](
+	db *bbolt.DB, bucket []byte, updates []models.Metric,
+	merge func(current *T, update models.Metric) (T, error),
+) error {
+	err := db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucket)
+		for _, update := range updates {
+			key := []byte(update.Key())
+			var current *T
+			if data := b.Get(key); data != nil {
+				var r record[T]
+				if err := json.Unmarshal(data, &r); err != nil {
+					return errors.Wrap(err, "json.Unmarshal")
+				}
+				current = &r.Value
+			}
+			value, err := merge(current, update)
+			if err != nil {
+				return err
+			}
+			data, err := json.Marshal(record[T]{Name: update.Name, Labels: update.Labels, Value: value})
+			if err != nil {
+				return errors.Wrap(err, "json.Marshal")
+			}
+			if err := b.Put(key, data); err != nil {
+				return errors.Wrap(err, "bucket.Put")
+			}
+		}
+		return nil
+	})
+
+	return errors.Wrap(err, "db.Update")
+}
+
+func getMetric[T any](
+	db *bbolt.DB, bucket []byte, mType, name string, labels map[string]string,
+) (models.Metric, error) {
+	key := models.SeriesKey(name, labels)
+	var metric models.Metric
+	err := db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(bucket).Get([]byte(key))
+		if data == nil {
+			return errors.Wrap(ErrMetricNotFound, key)
+		}
+		var err error
+		metric, err = decodeRecord[T](data, mType)
+		return err
+	})
+
+	return metric, err
+}
+
+func getMetrics[T any](db *bbolt.DB, bucket []byte, mType string) (map[string]models.Metric, error) {
+	metrics := make(map[string]models.Metric)
+	err := db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucket).ForEach(func(k, v []byte) error {
+			metric, err := decodeRecord[T](v, mType)
+			if err != nil {
+				return err
+			}
+			metrics[string(k)] = metric
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "db.View")
+	}
+
+	return metrics, nil
+}
+
+func decodeRecord[T any](data []byte, mType string) (models.Metric, error) {
+	var r record[T]
+	if err := json.Unmarshal(data, &r); err != nil {
+		return models.Metric{}, errors.Wrap(err, "json.Unmarshal")
+	}
+
+	return models.Metric{Name: r.Name, Labels: r.Labels, Type: mType, Value: metricValue(r.Value)}, nil
+}
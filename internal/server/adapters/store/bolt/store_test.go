@@ -0,0 +1,119 @@
+package bolt
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/VoevodinAnton/metrics/internal/server/config"
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Storage{Path: t.TempDir()}
+	labels := map[string]string{"host": "a"}
+	histogram := models.HistogramValue{Buckets: []float64{1}, Counts: []uint64{1, 0}, Sum: 0.5, Count: 1}
+
+	s, err := NewStore(cfg)
+	require.NoError(t, err)
+	require.NoError(t, s.PutCounterMetrics(ctx, []models.Metric{
+		{Name: "PollCount", Type: models.Counter, Value: int64(2)},
+		{Name: "PollCount", Type: models.Counter, Value: int64(3), Labels: labels},
+	}))
+	require.NoError(t, s.PutCounterMetric(ctx, models.Metric{Name: "PollCount", Type: models.Counter, Value: int64(4)}))
+	require.NoError(t, s.PutGaugeMetric(ctx, models.Metric{Name: "Alloc", Type: models.Gauge, Value: 1.5}))
+	require.NoError(t, s.PutHistogramMetric(ctx, models.Metric{Name: "latency", Type: models.Histogram, Value: histogram}))
+
+	// a bucket mismatch rolls the whole batch back
+	err = s.PutHistogramMetrics(ctx, []models.Metric{
+		{Name: "latency", Type: models.Histogram, Value: histogram},
+		{Name: "latency", Type: models.Histogram, Value: models.HistogramValue{
+			Buckets: []float64{2}, Counts: []uint64{1, 0}, Sum: 1, Count: 1,
+		}},
+	})
+	require.ErrorIs(t, err, models.ErrHistogramBucketMismatch)
+	s.Close()
+
+	s, err = NewStore(cfg)
+	require.NoError(t, err)
+	defer s.Close()
+
+	counter, err := s.GetCounterMetric(ctx, "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), counter.Value)
+	counters, err := s.GetCounterMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, models.Metric{Name: "PollCount", Type: models.Counter, Value: int64(3), Labels: labels},
+		counters[models.SeriesKey("PollCount", labels)])
+
+	gauge, err := s.GetGaugeMetric(ctx, "Alloc", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, gauge.Value)
+
+	h, err := s.GetHistogramMetric(ctx, "latency", nil)
+	require.NoError(t, err)
+	assert.Equal(t, histogram, h.Value)
+
+	_, err = s.GetGaugeMetric(ctx, "Missing", nil)
+	assert.ErrorIs(t, err, ErrMetricNotFound)
+
+	deleted, err := s.DeleteMetrics(ctx, []models.Metric{
+		{Name: "Alloc", Type: models.Gauge}, {Name: "Missing", Type: models.Gauge},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	_, err = s.GetGaugeMetric(ctx, "Alloc", nil)
+	assert.ErrorIs(t, err, ErrMetricNotFound)
+
+	reset, err := s.ResetCounterMetrics(ctx, []models.Metric{{Name: "PollCount", Type: models.Counter, Labels: labels}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, reset)
+	counter, err = s.GetCounterMetric(ctx, "PollCount", labels)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), counter.Value)
+}
+
+func TestStore_nonFiniteFloats(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Storage{Path: t.TempDir()}
+	histogram := models.HistogramValue{Buckets: []float64{1}, Counts: []uint64{0, 1}, Sum: math.Inf(1), Count: 1}
+
+	s, err := NewStore(cfg)
+	require.NoError(t, err)
+	require.NoError(t, s.PutGaugeMetrics(ctx, []models.Metric{
+		{Name: "NaN", Type: models.Gauge, Value: math.NaN()},
+		{Name: "PlusInf", Type: models.Gauge, Value: math.Inf(1)},
+		{Name: "MinusInf", Type: models.Gauge, Value: math.Inf(-1)},
+	}))
+	require.NoError(t, s.PutHistogramMetric(ctx, models.Metric{Name: "latency", Type: models.Histogram, Value: histogram}))
+	s.Close()
+
+	s, err = NewStore(cfg)
+	require.NoError(t, err)
+	defer s.Close()
+	gauges, err := s.GetGaugeMetrics(ctx)
+	require.NoError(t, err)
+	assert.True(t, math.IsNaN(gauges["NaN"].Value.(float64)))
+	assert.Equal(t, math.Inf(1), gauges["PlusInf"].Value)
+	assert.Equal(t, math.Inf(-1), gauges["MinusInf"].Value)
+	h, err := s.GetHistogramMetric(ctx, "latency", nil)
+	require.NoError(t, err)
+	assert.Equal(t, histogram, h.Value)
+}
+
+func TestFloat_UnmarshalJSON(t *testing.T) {
+	// a record written with the value as a plain number
+	var r record[float]
+	require.NoError(t, json.Unmarshal([]byte(`{"name":"Alloc","value":1.5}`), &r))
+	assert.Equal(t, float(1.5), r.Value)
+
+	data, err := json.Marshal(record[float]{Name: "Alloc", Value: float(1.5)})
+	require.NoError(t, err)
+	r = record[float]{}
+	require.NoError(t, json.Unmarshal(data, &r))
+	assert.Equal(t, float(1.5), r.Value)
+}
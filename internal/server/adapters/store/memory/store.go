@@ -10,53 +10,93 @@ import (
 	"github.com/VoevodinAnton/metrics/internal/server/models"
 )
 
+// shardCount is a power of two, so that a shard is picked by masking the hash.
+const shardCount = 64
+
 var (
-	ErrMetricNotFound = errors.New("metric not found")
+	ErrMetricNotFound = models.ErrMetricNotFound
 )
 
+// shard holds the series whose key hashes to it. Every read-modify-write of
+// a series runs under the shard lock, so concurrent counter increments and
+// histogram merges are never lost.
+type shard struct {
+	gauges     map[string]models.Metric
+	counters   map[string]models.Metric
+	histograms map[string]models.Metric
+	mu         sync.RWMutex
+}
+
+// Store keeps the metrics in hash-sharded maps, writers of different series
+// rarely contend for the same lock. The zero value is ready to use.
 type Store struct {
-	gaugeMetrics   sync.Map
-	counterMetrics sync.Map
-	sync.Mutex
+	shards [shardCount]shard
 }
 
 func NewStorage() *Store {
 	return &Store{}
 }
 
-func (s *Store) GetGaugeMetric(ctx context.Context, name string) (models.Metric, error) {
-	value, ok := s.gaugeMetrics.Load(name)
-	if !ok {
-		return models.Metric{}, errors.Wrap(ErrMetricNotFound, name)
+// shard returns the shard of the series key using FNV-1a.
+func (s *Store) shard(key string) *shard {
+	const (
+		offset = 2166136261
+		prime  = 16777619
+	)
+	h := uint32(offset)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= prime
 	}
+	return &s.shards[h&(shardCount-1)]
+}
+
+func (s *Store) GetGaugeMetric(ctx context.Context, name string, labels map[string]string) (models.Metric, error) {
+	return s.getMetric(name, labels, func(sh *shard) map[string]models.Metric { return sh.gauges })
+}
 
-	return value.(models.Metric), nil
+func (s *Store) GetCounterMetric(ctx context.Context, name string, labels map[string]string) (models.Metric, error) {
+	return s.getMetric(name, labels, func(sh *shard) map[string]models.Metric { return sh.counters })
 }
 
-func (s *Store) GetCounterMetric(ctx context.Context, name string) (models.Metric, error) {
-	value, ok := s.counterMetrics.Load(name)
+func (s *Store) GetHistogramMetric(ctx context.Context, name string, labels map[string]string) (models.Metric, error) {
+	return s.getMetric(name, labels, func(sh *shard) map[string]models.Metric { return sh.histograms })
+}
+
+func (s *Store) getMetric(
+	name string, labels map[string]string, metrics func(*shard) map[string]models.Metric,
+) (models.Metric, error) {
+	key := models.SeriesKey(name, labels)
+	sh := s.shard(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	metric, ok := metrics(sh)[key]
 	if !ok {
-		return models.Metric{}, errors.Wrap(ErrMetricNotFound, name)
+		return models.Metric{}, errors.Wrap(ErrMetricNotFound, key)
 	}
 
-	return value.(models.Metric), nil
+	return metric, nil
 }
 
 func (s *Store) PutCounterMetric(ctx context.Context, update models.Metric) error {
 	zap.L().Debug("store.counter.putCounterMetric", zap.Reflect("counterMetricPut", update))
-	m, ok := s.counterMetrics.Load(update.Name)
+	newValue, ok := update.Value.(int64)
 	if !ok {
-		s.counterMetrics.Store(update.Name, update)
-		return nil
-	}
-	metric, _ := m.(models.Metric)
-	value, _ := metric.Value.(int64)
-	if newValue, ok := update.Value.(int64); ok {
-		metric.Value = value + newValue
-	} else {
 		return errors.New("expected int64 type")
 	}
-	s.counterMetrics.Store(update.Name, metric)
+
+	key := update.Key()
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.counters == nil {
+		sh.counters = make(map[string]models.Metric)
+	}
+	if metric, ok := sh.counters[key]; ok {
+		value, _ := metric.Value.(int64)
+		update.Value = value + newValue
+	}
+	sh.counters[key] = update
 
 	return nil
 }
@@ -74,7 +114,15 @@ func (s *Store) PutCounterMetrics(ctx context.Context, updates []models.Metric)
 
 func (s *Store) PutGaugeMetric(ctx context.Context, update models.Metric) error {
 	zap.L().Debug("store.memory.putGaugeMetric", zap.Reflect("gaugeMetricPut", update))
-	s.gaugeMetrics.Store(update.Name, update)
+	key := update.Key()
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.gauges == nil {
+		sh.gauges = make(map[string]models.Metric)
+	}
+	sh.gauges[key] = update
+
 	return nil
 }
 
@@ -89,32 +137,130 @@ func (s *Store) PutGaugeMetrics(ctx context.Context, updates []models.Metric) er
 	return nil
 }
 
-func (s *Store) GetCounterMetrics(ctx context.Context) (map[string]models.Metric, error) {
-	data := make(map[string]models.Metric)
-	s.counterMetrics.Range(func(key, value any) bool {
-		s.Lock()
-		keyStr, _ := key.(string)
-		valueMetric, _ := value.(models.Metric)
-		data[keyStr] = valueMetric
-		s.Unlock()
-		return true
-	})
+func (s *Store) PutHistogramMetric(ctx context.Context, update models.Metric) error {
+	zap.L().Debug("store.memory.putHistogramMetric", zap.Reflect("histogramMetricPut", update))
+	h, ok := update.Value.(models.HistogramValue)
+	if !ok {
+		return errors.New("expected histogram type")
+	}
+
+	key := update.Key()
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.histograms == nil {
+		sh.histograms = make(map[string]models.Metric)
+	}
+	if metric, ok := sh.histograms[key]; ok {
+		current, _ := metric.Value.(models.HistogramValue)
+		merged, err := current.Merge(h)
+		if err != nil {
+			return errors.Wrap(err, key)
+		}
+		update.Value = merged
+	}
+	sh.histograms[key] = update
 
-	return data, nil
+	return nil
+}
+
+func (s *Store) PutHistogramMetrics(ctx context.Context, updates []models.Metric) error {
+	zap.L().Debug("store.memory.putHistogramMetrics", zap.Reflect("histogramMetricsPut", updates))
+	for _, update := range updates {
+		if err := s.PutHistogramMetric(ctx, update); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) GetCounterMetrics(ctx context.Context) (map[string]models.Metric, error) {
+	return s.getMetrics(func(sh *shard) map[string]models.Metric { return sh.counters }), nil
 }
 
 func (s *Store) GetGaugeMetrics(ctx context.Context) (map[string]models.Metric, error) {
+	return s.getMetrics(func(sh *shard) map[string]models.Metric { return sh.gauges }), nil
+}
+
+func (s *Store) GetHistogramMetrics(ctx context.Context) (map[string]models.Metric, error) {
+	return s.getMetrics(func(sh *shard) map[string]models.Metric { return sh.histograms }), nil
+}
+
+// getMetrics copies the metrics of every shard, one shard lock at a time.
+func (s *Store) getMetrics(metrics func(*shard) map[string]models.Metric) map[string]models.Metric {
 	data := make(map[string]models.Metric)
-	s.gaugeMetrics.Range(func(key, value any) bool {
-		s.Lock()
-		keyStr, _ := key.(string)
-		valueMetric, _ := value.(models.Metric)
-		data[keyStr] = valueMetric
-		s.Unlock()
-		return true
-	})
-
-	return data, nil
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		for key, metric := range metrics(sh) {
+			data[key] = metric
+		}
+		sh.mu.RUnlock()
+	}
+
+	return data
+}
+
+// DeleteMetrics removes the series of the metrics, the value is ignored. It
+// returns the number of series that existed.
+func (s *Store) DeleteMetrics(ctx context.Context, metrics []models.Metric) (int, error) {
+	zap.L().Debug("store.memory.deleteMetrics", zap.Reflect("metricsDelete", metrics))
+	var deleted int
+	for _, metric := range metrics {
+		key := metric.Key()
+		sh := s.shard(key)
+		sh.mu.Lock()
+		series := sh.series(metric.Type)
+		if _, ok := series[key]; ok {
+			delete(series, key)
+			deleted++
+		}
+		sh.mu.Unlock()
+	}
+
+	return deleted, nil
+}
+
+// ResetCounterMetrics sets the existing counters of the metrics to zero. It
+// returns the number of counters reset.
+func (s *Store) ResetCounterMetrics(ctx context.Context, metrics []models.Metric) (int, error) {
+	zap.L().Debug("store.memory.resetCounterMetrics", zap.Reflect("counterMetricsReset", metrics))
+	var reset int
+	for _, metric := range metrics {
+		key := metric.Key()
+		sh := s.shard(key)
+		sh.mu.Lock()
+		if current, ok := sh.counters[key]; ok {
+			current.Value = int64(0)
+			sh.counters[key] = current
+			reset++
+		}
+		sh.mu.Unlock()
+	}
+
+	return reset, nil
+}
+
+// series returns the map of the metric type, nil for an unknown one.
+func (sh *shard) series(mType string) map[string]models.Metric {
+	switch mType {
+	case models.Gauge:
+		return sh.gauges
+	case models.Counter:
+		return sh.counters
+	case models.Histogram:
+		return sh.histograms
+	}
+	return nil
+}
+
+func (s *Store) GetGaugeHistory(ctx context.Context, query models.HistoryQuery) ([]models.HistoryPoint, error) {
+	return nil, models.ErrHistoryNotSupported
+}
+
+func (s *Store) GetCounterHistory(ctx context.Context, query models.HistoryQuery) ([]models.HistoryPoint, error) {
+	return nil, models.ErrHistoryNotSupported
 }
 
 func (s *Store) Ping(ctx context.Context) error {
@@ -2,10 +2,15 @@ package memory
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/VoevodinAnton/metrics/internal/server/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestStorage_PutGaugeMetric(t *testing.T) {
@@ -59,14 +64,10 @@ func TestStorage_PutGaugeMetric(t *testing.T) {
 				t.Errorf("Failed update counter: %v", err)
 			}
 
-			m, found := s.gaugeMetrics.Load(tt.args.Metric.Name)
-			if !found {
+			metric, err := s.GetGaugeMetric(context.Background(), tt.args.Metric.Name, nil)
+			if err != nil {
 				t.Errorf("Metric %s not found", tt.args.Metric.Name)
 			}
-			metric, ok := m.(models.Metric)
-			if !ok {
-				t.Error("Metric type expected")
-			}
 
 			assert.Equal(t, tt.want, metric.Value)
 		})
@@ -113,16 +114,171 @@ func TestStorage_PutCounterMetric(t *testing.T) {
 				t.Errorf("Failed update counter: %v", err)
 			}
 
-			m, found := s.counterMetrics.Load(tt.args.Metric.Name)
-			if !found {
+			metric, err := s.GetCounterMetric(context.Background(), tt.args.Metric.Name, nil)
+			if err != nil {
 				t.Errorf("Metric %s not found", tt.args.Metric.Name)
 			}
-			metric, ok := m.(models.Metric)
-			if !ok {
-				t.Error("Metric type expected")
-			}
 
 			assert.Equal(t, tt.want, metric.Value)
 		})
 	}
 }
+
+func TestStorage_PutGaugeMetricLabels(t *testing.T) {
+	s := &Store{}
+	ctx := context.Background()
+	hostA := map[string]string{"hostname": "a"}
+	hostB := map[string]string{"hostname": "b"}
+
+	err := s.PutGaugeMetric(ctx, models.Metric{Name: "Alloc", Type: models.Gauge, Labels: hostA, Value: 1.0})
+	assert.NoError(t, err)
+	err = s.PutGaugeMetric(ctx, models.Metric{Name: "Alloc", Type: models.Gauge, Labels: hostB, Value: 2.0})
+	assert.NoError(t, err)
+
+	metricA, err := s.GetGaugeMetric(ctx, "Alloc", hostA)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, metricA.Value)
+
+	metricB, err := s.GetGaugeMetric(ctx, "Alloc", hostB)
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, metricB.Value)
+
+	_, err = s.GetGaugeMetric(ctx, "Alloc", nil)
+	assert.ErrorIs(t, err, ErrMetricNotFound)
+}
+
+func TestStorage_PutHistogramMetric(t *testing.T) {
+	s := &Store{}
+	ctx := context.Background()
+	update := models.Metric{Name: "Latency", Type: models.Histogram, Value: models.HistogramValue{
+		Buckets: []float64{0.1, 1}, Counts: []uint64{2, 1, 0}, Sum: 1.2, Count: 3,
+	}}
+
+	assert.NoError(t, s.PutHistogramMetric(ctx, update))
+	assert.NoError(t, s.PutHistogramMetric(ctx, update))
+
+	metric, err := s.GetHistogramMetric(ctx, "Latency", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, models.HistogramValue{
+		Buckets: []float64{0.1, 1}, Counts: []uint64{4, 2, 0}, Sum: 2.4, Count: 6,
+	}, metric.Value)
+
+	mismatch := update
+	mismatch.Value = models.HistogramValue{Buckets: []float64{0.5}, Counts: []uint64{1, 0}, Sum: 0.2, Count: 1}
+	assert.ErrorIs(t, s.PutHistogramMetric(ctx, mismatch), models.ErrHistogramBucketMismatch)
+
+	metrics, err := s.GetHistogramMetrics(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 1)
+}
+
+func TestStorage_DeleteMetrics(t *testing.T) {
+	s := &Store{}
+	ctx := context.Background()
+	hostA := map[string]string{"hostname": "a"}
+
+	assert.NoError(t, s.PutGaugeMetric(ctx, models.Metric{Name: "Alloc", Type: models.Gauge, Value: 1.0}))
+	assert.NoError(t, s.PutGaugeMetric(ctx, models.Metric{Name: "Alloc", Type: models.Gauge, Labels: hostA, Value: 2.0}))
+	assert.NoError(t, s.PutCounterMetric(ctx, models.Metric{Name: "Alloc", Type: models.Counter, Value: int64(3)}))
+
+	// only the series of the given type and labels is removed
+	deleted, err := s.DeleteMetrics(ctx, []models.Metric{
+		{Name: "Alloc", Type: models.Gauge}, {Name: "Missing", Type: models.Gauge}, {Name: "Alloc", Type: "unknown"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	_, err = s.GetGaugeMetric(ctx, "Alloc", nil)
+	assert.ErrorIs(t, err, ErrMetricNotFound)
+	_, err = s.GetGaugeMetric(ctx, "Alloc", hostA)
+	assert.NoError(t, err)
+
+	reset, err := s.ResetCounterMetrics(ctx, []models.Metric{{Name: "Alloc"}, {Name: "Missing"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, reset)
+	counter, err := s.GetCounterMetric(ctx, "Alloc", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), counter.Value)
+}
+
+func TestStorage_concurrentWriters(t *testing.T) {
+	const (
+		writers = 16
+		puts    = 1000
+	)
+	s := NewStorage()
+	ctx := context.Background()
+	histogram := models.HistogramValue{Buckets: []float64{1}, Counts: []uint64{1, 0}, Sum: 0.5, Count: 1}
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < puts; i++ {
+				assert.NoError(t, s.PutCounterMetric(ctx, models.Metric{Name: "PollCount", Type: models.Counter, Value: int64(1)}))
+				assert.NoError(t, s.PutHistogramMetric(ctx, models.Metric{Name: "Latency", Type: models.Histogram, Value: histogram}))
+				assert.NoError(t, s.PutGaugeMetric(ctx, models.Metric{
+					Name: "Alloc", Type: models.Gauge, Value: float64(i), Labels: map[string]string{"writer": strconv.Itoa(w)},
+				}))
+			}
+		}(w)
+	}
+	// readers run alongside the writers, the race detector checks them too
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < puts; i++ {
+			_, _ = s.GetCounterMetric(ctx, "PollCount", nil)
+			_, _ = s.GetGaugeMetrics(ctx)
+		}
+	}()
+	wg.Wait()
+	<-done
+
+	counter, err := s.GetCounterMetric(ctx, "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(writers*puts), counter.Value)
+	h, err := s.GetHistogramMetric(ctx, "Latency", nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(writers*puts), h.Value.(models.HistogramValue).Count)
+	gauges, err := s.GetGaugeMetrics(ctx)
+	require.NoError(t, err)
+	assert.Len(t, gauges, writers)
+}
+
+func BenchmarkStorage_PutCounterMetric(b *testing.B) {
+	ctx := context.Background()
+	for _, series := range []int{1, 1000} {
+		b.Run(fmt.Sprintf("series/%d", series), func(b *testing.B) {
+			s := NewStorage()
+			names := make([]string, series)
+			for i := range names {
+				names[i] = "Counter" + strconv.Itoa(i)
+			}
+			var next atomic.Int64
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					name := names[int(next.Add(1))%series]
+					if err := s.PutCounterMetric(ctx, models.Metric{Name: name, Type: models.Counter, Value: int64(1)}); err != nil {
+						b.Error(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkStorage_PutGaugeMetric(b *testing.B) {
+	ctx := context.Background()
+	s := NewStorage()
+	var next atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := next.Add(1)
+			name := "Gauge" + strconv.Itoa(int(i%1000))
+			if err := s.PutGaugeMetric(ctx, models.Metric{Name: name, Type: models.Gauge, Value: float64(i)}); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
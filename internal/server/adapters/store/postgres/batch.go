@@ -0,0 +1,174 @@
+package postgres
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+)
+
+// historyColumns are the columns copied into the raw history tables.
+var historyColumns = []string{"name", "labels", "value", "updated_at"}
+
+// write describes how a batch of one metric type is stored: the rows copied
+// into the history table, if there is one, and the upsert of the current
+// value queued for every series.
+type write struct {
+	mType        string
+	historyTable string
+	upsertQuery  string
+	upsertArgs   func(update models.Metric, updatedAt int64) ([]any, error)
+	// checkUpsert inspects the result of the upsert of update.
+	checkUpsert func(update models.Metric, tag pgconn.CommandTag) error
+}
+
+var (
+	gaugeWrite = write{
+		mType:        models.Gauge,
+		historyTable: "gauge_metrics",
+		upsertQuery:  upsertGaugeCurrentQuery,
+		upsertArgs:   valueArgs,
+	}
+	counterWrite = write{
+		mType:        models.Counter,
+		historyTable: "counter_metrics",
+		upsertQuery:  upsertCounterCurrentQuery,
+		upsertArgs:   valueArgs,
+	}
+	histogramWrite = write{
+		mType:       models.Histogram,
+		upsertQuery: upsertHistogramMetricQuery,
+		upsertArgs:  histogramArgs,
+		checkUpsert: func(update models.Metric, tag pgconn.CommandTag) error {
+			// the upsert skips the row if the stored bucket boundaries differ
+			if tag.RowsAffected() == 0 {
+				return errors.Wrap(models.ErrHistogramBucketMismatch, update.Key())
+			}
+			return nil
+		},
+	}
+)
+
+// putMetrics writes the batch in one transaction. The repeated series are
+// aggregated first, then the history rows go in with COPY and the upserts of
+// the current values are sent in a single round trip.
+func (s *Store) putMetrics(ctx context.Context, updates []models.Metric, w write) error {
+	updates, err := aggregate(w.mType, updates)
+	if err != nil {
+		return err
+	}
+	updatedAt := time.Now().UnixNano()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "db.Begin")
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	if w.historyTable != "" {
+		rows := make([][]any, 0, len(updates))
+		for _, update := range updates {
+			rows = append(rows, []any{update.Name, labelsOrEmpty(update.Labels), update.Value, updatedAt})
+		}
+		_, err := tx.CopyFrom(ctx, pgx.Identifier{w.historyTable}, historyColumns, pgx.CopyFromRows(rows))
+		if err != nil {
+			return errors.Wrap(err, "tx.CopyFrom")
+		}
+	}
+
+	batch := &pgx.Batch{}
+	for _, update := range updates {
+		args, err := w.upsertArgs(update, updatedAt)
+		if err != nil {
+			return err
+		}
+		q := batch.Queue(w.upsertQuery, args...)
+		if w.checkUpsert != nil {
+			update := update
+			q.Exec(func(tag pgconn.CommandTag) error {
+				return w.checkUpsert(update, tag)
+			})
+		}
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return errors.Wrap(err, "batch")
+	}
+
+	return tx.Commit(ctx) //nolint: wrapcheck //unnecessary
+}
+
+func valueArgs(update models.Metric, updatedAt int64) ([]any, error) {
+	return []any{update.Name, labelsOrEmpty(update.Labels), update.Value, updatedAt}, nil
+}
+
+func histogramArgs(update models.Metric, updatedAt int64) ([]any, error) {
+	h, ok := update.Value.(models.HistogramValue)
+	if !ok {
+		return nil, errors.New("expected histogram type")
+	}
+	counts := make([]int64, len(h.Counts))
+	for i, c := range h.Counts {
+		counts[i] = int64(c)
+	}
+
+	return []any{update.Name, labelsOrEmpty(update.Labels),
+		h.Buckets, counts, h.Sum, int64(h.Count), updatedAt}, nil
+}
+
+// aggregate folds the updates of the same series into one: the deltas of a
+// counter are summed, a gauge keeps its last value and histograms are
+// merged. The result is ordered by series, so that concurrent batches lock
+// the rows in the same order.
+func aggregate(mType string, updates []models.Metric) ([]models.Metric, error) {
+	series := make(map[string]models.Metric, len(updates))
+	for _, update := range updates {
+		key := update.Key()
+		current, ok := series[key]
+		if !ok {
+			series[key] = update
+			continue
+		}
+		switch mType {
+		case models.Counter:
+			value, ok1 := current.Value.(int64)
+			delta, ok2 := update.Value.(int64)
+			if !ok1 || !ok2 {
+				return nil, errors.New("expected int64 type")
+			}
+			current.Value = value + delta
+		case models.Gauge:
+			current.Value = update.Value
+		case models.Histogram:
+			value, ok1 := current.Value.(models.HistogramValue)
+			h, ok2 := update.Value.(models.HistogramValue)
+			if !ok1 || !ok2 {
+				return nil, errors.New("expected histogram type")
+			}
+			merged, err := value.Merge(h)
+			if err != nil {
+				return nil, errors.Wrap(err, key)
+			}
+			current.Value = merged
+		}
+		series[key] = current
+	}
+
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]models.Metric, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, series[key])
+	}
+
+	return result, nil
+}
@@ -0,0 +1,182 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+	"github.com/VoevodinAnton/metrics/pkg/config"
+	"github.com/VoevodinAnton/metrics/pkg/postgres"
+)
+
+func TestAggregate(t *testing.T) {
+	labels := map[string]string{"host": "a"}
+	histogram := func(counts ...uint64) models.HistogramValue {
+		var count uint64
+		for _, c := range counts {
+			count += c
+		}
+		return models.HistogramValue{Buckets: []float64{1}, Counts: counts, Count: count}
+	}
+
+	tests := []struct {
+		wantErr error
+		name    string
+		mType   string
+		updates []models.Metric
+		want    []models.Metric
+	}{
+		{
+			name:  "counters are summed per series",
+			mType: models.Counter,
+			updates: []models.Metric{
+				{Name: "b", Value: int64(1)},
+				{Name: "a", Value: int64(2)},
+				{Name: "b", Value: int64(3)},
+				{Name: "b", Value: int64(4), Labels: labels},
+			},
+			want: []models.Metric{
+				{Name: "a", Value: int64(2)},
+				{Name: "b", Value: int64(4)},
+				{Name: "b", Value: int64(4), Labels: labels},
+			},
+		},
+		{
+			name:    "the last gauge value wins",
+			mType:   models.Gauge,
+			updates: []models.Metric{{Name: "a", Value: 1.0}, {Name: "a", Value: 2.0}},
+			want:    []models.Metric{{Name: "a", Value: 2.0}},
+		},
+		{
+			name:    "histograms are merged",
+			mType:   models.Histogram,
+			updates: []models.Metric{{Name: "a", Value: histogram(1, 0)}, {Name: "a", Value: histogram(0, 2)}},
+			want:    []models.Metric{{Name: "a", Value: histogram(1, 2)}},
+		},
+		{
+			name:  "histogram bucket mismatch",
+			mType: models.Histogram,
+			updates: []models.Metric{
+				{Name: "a", Value: histogram(1, 0)},
+				{Name: "a", Value: models.HistogramValue{Buckets: []float64{2}, Counts: []uint64{0, 0}}},
+			},
+			wantErr: models.ErrHistogramBucketMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := aggregate(tt.mType, tt.updates)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// BenchmarkStore_PutMetrics needs a database, set DATABASE_DSN to run it.
+func BenchmarkStore_PutMetrics(b *testing.B) {
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" {
+		b.Skip("DATABASE_DSN is not set")
+	}
+	ctx := context.Background()
+	db, err := postgres.NewPgxConn(ctx, &config.Postgres{DatabaseDSN: dsn})
+	require.NoError(b, err)
+	s := NewStore(db)
+	defer s.Close()
+
+	for _, size := range []int{1000, 10000} {
+		gauges := make([]models.Metric, size)
+		counters := make([]models.Metric, size)
+		for i := range gauges {
+			labels := map[string]string{"bench": strconv.Itoa(i)}
+			gauges[i] = models.Metric{Name: "BenchGauge", Type: models.Gauge, Value: float64(i), Labels: labels}
+			counters[i] = models.Metric{Name: "BenchCounter", Type: models.Counter, Value: int64(1), Labels: labels}
+		}
+
+		b.Run(fmt.Sprintf("gauges/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				require.NoError(b, s.PutGaugeMetrics(ctx, gauges))
+			}
+			b.ReportMetric(float64(size*b.N)/b.Elapsed().Seconds(), "metrics/s")
+		})
+		b.Run(fmt.Sprintf("gauges/%d/per-row", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				require.NoError(b, putMetricsPerRow(ctx, s, gauges, gaugeWrite))
+			}
+			b.ReportMetric(float64(size*b.N)/b.Elapsed().Seconds(), "metrics/s")
+		})
+		b.Run(fmt.Sprintf("counters/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				require.NoError(b, s.PutCounterMetrics(ctx, counters))
+			}
+			b.ReportMetric(float64(size*b.N)/b.Elapsed().Seconds(), "metrics/s")
+		})
+		b.Run(fmt.Sprintf("counters/%d/per-row", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				require.NoError(b, putMetricsPerRow(ctx, s, counters, counterWrite))
+			}
+			b.ReportMetric(float64(size*b.N)/b.Elapsed().Seconds(), "metrics/s")
+		})
+	}
+}
+
+// putMetricsPerRow is the write path replaced by putMetrics, kept as the
+// baseline of the benchmark: the history insert and the upsert of the
+// current value are prepared and executed for every update in turn.
+func putMetricsPerRow(ctx context.Context, s *Store, updates []models.Metric, w write) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "db.Begin")
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+	insertQuery := `INSERT INTO ` + w.historyTable + ` (name, labels, value, updated_at) VALUES ($1, $2, $3, $4);`
+	if _, err := tx.Prepare(ctx, "insertHistory", insertQuery); err != nil {
+		return errors.Wrap(err, "tx.Prepare")
+	}
+	if _, err := tx.Prepare(ctx, "upsertCurrent", w.upsertQuery); err != nil {
+		return errors.Wrap(err, "tx.Prepare")
+	}
+	for _, update := range updates {
+		updatedAt := time.Now().UnixNano()
+		for _, name := range []string{"insertHistory", "upsertCurrent"} {
+			_, err := tx.Exec(ctx, name, update.Name, labelsOrEmpty(update.Labels), update.Value, updatedAt)
+			if err != nil {
+				return errors.Wrap(err, "tx.Exec")
+			}
+		}
+	}
+
+	return errors.Wrap(tx.Commit(ctx), "tx.Commit")
+}
+
+func BenchmarkAggregate(b *testing.B) {
+	for _, size := range []int{1000, 10000} {
+		// every series is repeated ten times in the batch
+		updates := make([]models.Metric, size)
+		for i := range updates {
+			updates[i] = models.Metric{Name: "BenchCounter" + strconv.Itoa(i%(size/10)), Value: int64(1)}
+		}
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := aggregate(models.Counter, updates); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(size*b.N)/b.Elapsed().Seconds(), "metrics/s")
+		})
+	}
+}
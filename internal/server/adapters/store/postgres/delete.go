@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+)
+
+var deleteMetricQueries = map[string]string{
+	models.Gauge:     deleteGaugeMetricQuery,
+	models.Counter:   deleteCounterMetricQuery,
+	models.Histogram: deleteHistogramMetricQuery,
+}
+
+// DeleteMetrics removes the series of the metrics with their history in one
+// transaction and returns the number of series that existed.
+func (s *Store) DeleteMetrics(ctx context.Context, metrics []models.Metric) (deleted int, err error) {
+	zap.L().Debug("store.postgres.deleteMetrics", zap.Reflect("metricsDelete", metrics))
+	err = s.retrier.Do(ctx, func() error {
+		deleted, err = s.execSeries(ctx, metrics, func(metric models.Metric) (string, []any) {
+			return deleteMetricQueries[metric.Type], []any{metric.Name, labelsOrEmpty(metric.Labels)}
+		})
+		return err
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "execSeries delete")
+	}
+
+	return deleted, nil
+}
+
+// ResetCounterMetrics sets the existing counters of the metrics to zero in
+// one transaction and returns the number of counters reset.
+func (s *Store) ResetCounterMetrics(ctx context.Context, metrics []models.Metric) (reset int, err error) {
+	zap.L().Debug("store.postgres.resetCounterMetrics", zap.Reflect("counterMetricsReset", metrics))
+	updatedAt := time.Now().UnixNano()
+	err = s.retrier.Do(ctx, func() error {
+		reset, err = s.execSeries(ctx, metrics, func(metric models.Metric) (string, []any) {
+			return resetCounterMetricQuery, []any{metric.Name, labelsOrEmpty(metric.Labels), updatedAt}
+		})
+		return err
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "execSeries reset")
+	}
+
+	return reset, nil
+}
+
+// execSeries sends the statement of every metric in a single round trip and
+// sums the affected rows. A metric without a statement is skipped.
+func (s *Store) execSeries(
+	ctx context.Context, metrics []models.Metric, statement func(models.Metric) (string, []any),
+) (int, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "db.Begin")
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var affected int
+	batch := &pgx.Batch{}
+	for _, metric := range metrics {
+		query, args := statement(metric)
+		if query == "" {
+			continue
+		}
+		batch.Queue(query, args...).Exec(func(tag pgconn.CommandTag) error {
+			affected += int(tag.RowsAffected())
+			return nil
+		})
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return 0, errors.Wrap(err, "batch")
+	}
+
+	return affected, tx.Commit(ctx) //nolint: wrapcheck //unnecessary
+}
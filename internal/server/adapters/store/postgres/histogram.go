@@ -0,0 +1,87 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+)
+
+func (s *Store) GetHistogramMetric(ctx context.Context, name string, labels map[string]string) (models.Metric, error) {
+	var metric models.Metric
+	err := s.retrier.Do(ctx, func() error {
+		var err error
+		metric, err = scanHistogram(s.db.QueryRow(ctx, getHistogramMetricQuery, name, labelsOrEmpty(labels)))
+		return err
+	})
+	if err != nil {
+		return models.Metric{}, errors.Wrap(notFound(err, name), "row.Scan histogram")
+	}
+
+	return metric, nil
+}
+
+func (s *Store) GetHistogramMetrics(ctx context.Context) (metrics map[string]models.Metric, err error) {
+	err = s.retrier.Do(ctx, func() error {
+		metrics, err = s.queryHistogramMetrics(ctx)
+		return err
+	})
+	return metrics, err
+}
+
+func (s *Store) queryHistogramMetrics(ctx context.Context) (map[string]models.Metric, error) {
+	rows, err := s.db.Query(ctx, getHistogramMetricsQuery)
+	if err != nil {
+		return nil, errors.Wrap(err, "db.Query histogram")
+	}
+	defer rows.Close()
+
+	metrics := make(map[string]models.Metric, 0)
+	for rows.Next() {
+		metric, err := scanHistogram(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "rows.Scan histogram")
+		}
+		metrics[metric.Key()] = metric
+	}
+
+	return metrics, errors.Wrap(rows.Err(), "rows.Err")
+}
+
+func (s *Store) PutHistogramMetric(ctx context.Context, update models.Metric) error {
+	zap.L().Debug("store.postgres.putHistogramMetric", zap.Reflect("histogramMetricPut", update))
+	err := s.counterRetrier.Do(ctx, func() error {
+		return s.putMetrics(ctx, []models.Metric{update}, histogramWrite)
+	})
+
+	return errors.Wrap(err, "putMetrics histogram")
+}
+
+func (s *Store) PutHistogramMetrics(ctx context.Context, updates []models.Metric) error {
+	zap.L().Debug("store.postgres.putHistogramMetrics", zap.Reflect("histogramMetricsPut", updates))
+
+	return s.counterRetrier.Do(ctx, func() error {
+		return s.putMetrics(ctx, updates, histogramWrite)
+	})
+}
+
+func scanHistogram(row pgx.Row) (models.Metric, error) {
+	metric := models.Metric{Type: models.Histogram}
+	var h models.HistogramValue
+	var counts []int64
+	var count int64
+	if err := row.Scan(&metric.Name, &metric.Labels, &h.Buckets, &counts, &h.Sum, &count); err != nil {
+		return models.Metric{}, err //nolint: wrapcheck // wrapped by the callers
+	}
+	h.Counts = make([]uint64, len(counts))
+	for i, c := range counts {
+		h.Counts[i] = uint64(c)
+	}
+	h.Count = uint64(count)
+	metric.Value = h
+
+	return metric, nil
+}
@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+func (s *Store) GetGaugeHistory(ctx context.Context, query models.HistoryQuery) ([]models.HistoryPoint, error) {
+	if query.Step == 0 {
+		return s.getHistory(ctx, getGaugeHistoryQuery, query, func(rows pgx.Rows, p *models.HistoryPoint) error {
+			var ts int64
+			err := rows.Scan(&ts, &p.Value)
+			p.Time = time.Unix(0, ts)
+			return errors.Wrap(err, "rows.Scan gauge")
+		})
+	}
+
+	return s.getHistory(ctx, getGaugeHistoryBucketsQuery, query, func(rows pgx.Rows, p *models.HistoryPoint) error {
+		var ts int64
+		err := rows.Scan(&ts, &p.Avg, &p.Min, &p.Max, &p.Value)
+		p.Time = time.Unix(0, ts)
+		return errors.Wrap(err, "rows.Scan gauge bucket")
+	})
+}
+
+func (s *Store) GetCounterHistory(ctx context.Context, query models.HistoryQuery) ([]models.HistoryPoint, error) {
+	if query.Step == 0 {
+		return s.getHistory(ctx, getCounterHistoryQuery, query, func(rows pgx.Rows, p *models.HistoryPoint) error {
+			var ts int64
+			err := rows.Scan(&ts, &p.Delta)
+			p.Time = time.Unix(0, ts)
+			return errors.Wrap(err, "rows.Scan counter")
+		})
+	}
+
+	return s.getHistory(ctx, getCounterHistoryBucketsQuery, query, func(rows pgx.Rows, p *models.HistoryPoint) error {
+		var ts int64
+		if err := rows.Scan(&ts, &p.Delta); err != nil {
+			return errors.Wrap(err, "rows.Scan counter bucket")
+		}
+		p.Time = time.Unix(0, ts)
+		return nil
+	})
+}
+
+func (s *Store) getHistory(
+	ctx context.Context,
+	query string,
+	q models.HistoryQuery,
+	scan func(rows pgx.Rows, p *models.HistoryPoint) error,
+) (points []models.HistoryPoint, err error) {
+	err = s.retrier.Do(ctx, func() error {
+		points, err = s.queryHistory(ctx, query, q, scan)
+		return err
+	})
+	return points, err
+}
+
+func (s *Store) queryHistory(
+	ctx context.Context,
+	query string,
+	q models.HistoryQuery,
+	scan func(rows pgx.Rows, p *models.HistoryPoint) error,
+) ([]models.HistoryPoint, error) {
+	args := []any{q.Name, labelsOrEmpty(q.Labels), q.From.UnixNano(), q.To.UnixNano()}
+	if q.Step != 0 {
+		args = append(args, q.Step.Nanoseconds())
+	}
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "db.Query history")
+	}
+	defer rows.Close()
+
+	points := make([]models.HistoryPoint, 0)
+	for rows.Next() {
+		var p models.HistoryPoint
+		if err := scan(rows, &p); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows.Err")
+	}
+
+	return points, nil
+}
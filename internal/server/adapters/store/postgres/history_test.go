@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+	"github.com/VoevodinAnton/metrics/pkg/config"
+	"github.com/VoevodinAnton/metrics/pkg/postgres"
+)
+
+// TestStore_historyBuckets needs a database, set DATABASE_DSN to run it.
+func TestStore_historyBuckets(t *testing.T) {
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("DATABASE_DSN is not set")
+	}
+	ctx := context.Background()
+	db, err := postgres.NewPgxConn(ctx, &config.Postgres{DatabaseDSN: dsn})
+	require.NoError(t, err)
+	s := NewStore(db)
+	defer s.Close()
+
+	labels := map[string]string{"test": strconv.FormatInt(time.Now().UnixNano(), 10)}
+	t.Cleanup(func() {
+		_, err := s.DeleteMetrics(ctx, []models.Metric{
+			{Name: "HistoryGauge", Type: models.Gauge, Labels: labels},
+			{Name: "HistoryCounter", Type: models.Counter, Labels: labels},
+		})
+		assert.NoError(t, err)
+	})
+
+	// the first minute has raw rows only, the second one a rollup row and a
+	// raw row written after it
+	t0 := time.Unix(1699999980, 0)
+	at := func(d time.Duration) int64 { return t0.Add(d).UnixNano() }
+	for _, row := range []struct {
+		query string
+		args  []any
+	}{
+		{`INSERT INTO gauge_metrics (name, labels, value, updated_at) VALUES ($1, $2, $3, $4)`,
+			[]any{"HistoryGauge", labels, 1.0, at(10 * time.Second)}},
+		{`INSERT INTO gauge_metrics (name, labels, value, updated_at) VALUES ($1, $2, $3, $4)`,
+			[]any{"HistoryGauge", labels, 4.0, at(20 * time.Second)}},
+		{`INSERT INTO gauge_metrics (name, labels, value, updated_at) VALUES ($1, $2, $3, $4)`,
+			[]any{"HistoryGauge", labels, 2.0, at(30 * time.Second)}},
+		{`INSERT INTO gauge_metrics_1m (name, labels, bucket, avg, min, max, last, count)
+			VALUES ($1, $2, $3, 5, 3, 8, 6, 4)`,
+			[]any{"HistoryGauge", labels, at(time.Minute)}},
+		{`INSERT INTO gauge_metrics (name, labels, value, updated_at) VALUES ($1, $2, $3, $4)`,
+			[]any{"HistoryGauge", labels, 10.0, at(90 * time.Second)}},
+		{`INSERT INTO counter_metrics (name, labels, value, updated_at) VALUES ($1, $2, $3, $4)`,
+			[]any{"HistoryCounter", labels, int64(2), at(10 * time.Second)}},
+		{`INSERT INTO counter_metrics (name, labels, value, updated_at) VALUES ($1, $2, $3, $4)`,
+			[]any{"HistoryCounter", labels, int64(3), at(20 * time.Second)}},
+		{`INSERT INTO counter_metrics_1m (name, labels, bucket, value, count) VALUES ($1, $2, $3, 7, 3)`,
+			[]any{"HistoryCounter", labels, at(time.Minute)}},
+		{`INSERT INTO counter_metrics (name, labels, value, updated_at) VALUES ($1, $2, $3, $4)`,
+			[]any{"HistoryCounter", labels, int64(1), at(70 * time.Second)}},
+	} {
+		_, err := db.Exec(ctx, row.query, row.args...)
+		require.NoError(t, err)
+	}
+	query := func(name string) models.HistoryQuery {
+		return models.HistoryQuery{
+			Name: name, Labels: labels, From: t0, To: t0.Add(2 * time.Minute), Step: time.Minute,
+		}
+	}
+
+	gauges, err := s.GetGaugeHistory(ctx, query("HistoryGauge"))
+	require.NoError(t, err)
+	require.Len(t, gauges, 2)
+	assert.True(t, t0.Equal(gauges[0].Time))
+	assert.InDelta(t, 7.0/3, gauges[0].Avg, 1e-9)
+	assert.Equal(t, []float64{1, 4, 2}, []float64{gauges[0].Min, gauges[0].Max, gauges[0].Value})
+	assert.True(t, t0.Add(time.Minute).Equal(gauges[1].Time))
+	assert.InDelta(t, 6.0, gauges[1].Avg, 1e-9, "the rollup row weighs its count")
+	assert.Equal(t, []float64{3, 10, 10}, []float64{gauges[1].Min, gauges[1].Max, gauges[1].Value})
+
+	counters, err := s.GetCounterHistory(ctx, query("HistoryCounter"))
+	require.NoError(t, err)
+	require.Len(t, counters, 2)
+	assert.Equal(t, []int64{5, 8}, []int64{counters[0].Delta, counters[1].Delta})
+}
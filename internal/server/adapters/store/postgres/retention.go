@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Compact rolls up and expires the stored rows according to the policy.
+// All steps run in one transaction so that counter sums never observe
+// a row both in its source and in its destination table.
+func (s *Store) Compact(ctx context.Context, policy models.RetentionPolicy, now time.Time) (models.CompactionStats, error) {
+	var stats models.CompactionStats
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return stats, errors.Wrap(err, "db.Begin")
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	rawCutoff := now.Add(-policy.Raw).Truncate(time.Minute).UnixNano()
+	minuteCutoff := now.Add(-policy.Minute).Truncate(time.Hour).UnixNano()
+	hourCutoff := now.Add(-policy.Hour).Truncate(time.Hour).UnixNano()
+
+	steps := []struct {
+		rows  *int64
+		query string
+		args  []any
+	}{
+		{&stats.GaugeRawRows, compactRawGaugeMetricsQuery, []any{rawCutoff, time.Minute.Nanoseconds()}},
+		{&stats.CounterRawRows, compactRawCounterMetricsQuery, []any{rawCutoff, time.Minute.Nanoseconds()}},
+		{&stats.GaugeMinuteRows, compactMinuteGaugeMetricsQuery, []any{minuteCutoff, time.Hour.Nanoseconds()}},
+		{&stats.CounterMinuteRows, compactMinuteCounterMetricsQuery, []any{minuteCutoff, time.Hour.Nanoseconds()}},
+		{&stats.CounterHourRows, expireHourCounterMetricsQuery, []any{hourCutoff}},
+	}
+	for _, step := range steps {
+		if err := tx.QueryRow(ctx, step.query, step.args...).Scan(step.rows); err != nil {
+			return stats, errors.Wrap(err, "tx.QueryRow compact")
+		}
+	}
+
+	tag, err := tx.Exec(ctx, expireHourGaugeMetricsQuery, hourCutoff)
+	if err != nil {
+		return stats, errors.Wrap(err, "tx.Exec expire")
+	}
+	stats.GaugeHourRows = tag.RowsAffected()
+
+	if err := tx.Commit(ctx); err != nil {
+		return stats, errors.Wrap(err, "tx.Commit")
+	}
+	zap.L().Debug("store.postgres.compact", zap.Reflect("stats", stats))
+
+	return stats, nil
+}
@@ -1,23 +1,173 @@
 package postgres
 
 const (
-	getCounterMetricQuery = `SELECT name, sum(value) FROM counter_metrics WHERE name = $1
-		GROUP BY name;`
-	getGaugeMetricQuery = `SELECT name, value FROM gauge_metrics WHERE name = $1
-		ORDER BY updated_at DESC LIMIT 1;`
-	insertGaugeMetricQuery   = `INSERT INTO gauge_metrics (name, value, updated_at) VALUES ($1, $2, $3);`
-	insertCounterMetricQuery = `INSERT INTO counter_metrics (name, value, updated_at) VALUES ($1, $2, $3);`
-	getGaugeMetricsQuery     = `SELECT name, value FROM gauge_metrics gm1 WHERE updated_at  = (
-		SELECT MAX(updated_at)
-		FROM gauge_metrics gm2
-		WHERE gm2.name = gm1.name
-	);`
-	getCounterMetricsQuery = `SELECT name, value FROM counter_metrics cm1 WHERE updated_at  = (
-		SELECT MAX(updated_at)
-		FROM counter_metrics cm2
-		WHERE cm2.name = cm1.name
-	);`
+	// The current values are read from one row per series, they are upserted
+	// in the transaction that copies the history rows.
+	getCounterMetricQuery = `SELECT name, labels, value FROM counter_metrics_current
+		WHERE name = $1 AND labels = $2;`
+	getGaugeMetricQuery = `SELECT name, labels, value FROM gauge_metrics_current
+		WHERE name = $1 AND labels = $2;`
+	getCounterMetricsQuery  = `SELECT name, labels, value FROM counter_metrics_current;`
+	getGaugeMetricsQuery    = `SELECT name, labels, value FROM gauge_metrics_current;`
+	upsertGaugeCurrentQuery = `INSERT INTO gauge_metrics_current AS c (name, labels, value, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name, labels) DO UPDATE SET
+			value = excluded.value,
+			updated_at = excluded.updated_at
+		WHERE c.updated_at <= excluded.updated_at;`
+	upsertCounterCurrentQuery = `INSERT INTO counter_metrics_current AS c (name, labels, value, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name, labels) DO UPDATE SET
+			value = c.value + excluded.value,
+			updated_at = GREATEST(c.updated_at, excluded.updated_at);`
 
-	insertGaugeMetricQueryName   = "insertGaugeMetricQuery"
-	insertCounterMetricQueryName = "insertCounterMetricQuery"
+	// The history queries read the raw table together with the rollup tables,
+	// a rollup row is returned as a point at the start of its bucket.
+	getGaugeHistoryQuery = `SELECT ts, last FROM (
+		SELECT updated_at AS ts, value AS last FROM gauge_metrics WHERE name = $1 AND labels = $2
+		UNION ALL
+		SELECT bucket, last FROM gauge_metrics_1m WHERE name = $1 AND labels = $2
+		UNION ALL
+		SELECT bucket, last FROM gauge_metrics_1h WHERE name = $1 AND labels = $2
+	) AS gauge WHERE ts >= $3 AND ts < $4
+		ORDER BY ts;`
+	getCounterHistoryQuery = `SELECT ts, value FROM (
+		SELECT updated_at AS ts, value FROM counter_metrics WHERE name = $1 AND labels = $2
+		UNION ALL
+		SELECT bucket, value FROM counter_metrics_1m WHERE name = $1 AND labels = $2
+		UNION ALL
+		SELECT bucket, value FROM counter_metrics_1h WHERE name = $1 AND labels = $2
+	) AS counter WHERE ts >= $3 AND ts < $4
+		ORDER BY ts;`
+	getGaugeHistoryBucketsQuery = `SELECT ts - ts % $5 AS bucket,
+		sum(avg * count) / sum(count), min(min), max(max), (array_agg(last ORDER BY ts DESC))[1]
+		FROM (
+			SELECT updated_at AS ts, value AS avg, value AS min, value AS max, value AS last, 1 AS count
+			FROM gauge_metrics WHERE name = $1 AND labels = $2
+			UNION ALL
+			SELECT bucket, avg, min, max, last, count FROM gauge_metrics_1m WHERE name = $1 AND labels = $2
+			UNION ALL
+			SELECT bucket, avg, min, max, last, count FROM gauge_metrics_1h WHERE name = $1 AND labels = $2
+		) AS gauge WHERE ts >= $3 AND ts < $4
+		GROUP BY bucket ORDER BY bucket;`
+	getCounterHistoryBucketsQuery = `SELECT ts - ts % $5 AS bucket, sum(value)::BIGINT
+		FROM (
+			SELECT updated_at AS ts, value FROM counter_metrics WHERE name = $1 AND labels = $2
+			UNION ALL
+			SELECT bucket, value FROM counter_metrics_1m WHERE name = $1 AND labels = $2
+			UNION ALL
+			SELECT bucket, value FROM counter_metrics_1h WHERE name = $1 AND labels = $2
+		) AS counter WHERE ts >= $3 AND ts < $4
+		GROUP BY bucket ORDER BY bucket;`
+
+	// The compaction queries move rows older than $1 into buckets of $2
+	// nanoseconds. The latest raw row of every series is kept, so that the
+	// history of a series always ends with its last point at full resolution.
+	compactRawGaugeMetricsQuery = `WITH moved AS (
+		DELETE FROM gauge_metrics gm1 WHERE updated_at < $1 AND updated_at < (
+			SELECT MAX(updated_at)
+			FROM gauge_metrics gm2
+			WHERE gm2.name = gm1.name AND gm2.labels = gm1.labels
+		) RETURNING name, labels, value, updated_at
+	), rolled AS (
+		INSERT INTO gauge_metrics_1m AS r (name, labels, bucket, avg, min, max, last, count)
+		SELECT name, labels, updated_at - updated_at % $2, avg(value), min(value), max(value),
+			(array_agg(value ORDER BY updated_at DESC))[1], count(*)
+		FROM moved GROUP BY name, labels, updated_at - updated_at % $2
+		ON CONFLICT (name, labels, bucket) DO UPDATE SET
+			avg = (r.avg * r.count + excluded.avg * excluded.count) / (r.count + excluded.count),
+			min = LEAST(r.min, excluded.min),
+			max = GREATEST(r.max, excluded.max),
+			last = excluded.last,
+			count = r.count + excluded.count
+	) SELECT count(*) FROM moved;`
+	compactRawCounterMetricsQuery = `WITH moved AS (
+		DELETE FROM counter_metrics cm1 WHERE updated_at < $1 AND updated_at < (
+			SELECT MAX(updated_at)
+			FROM counter_metrics cm2
+			WHERE cm2.name = cm1.name AND cm2.labels = cm1.labels
+		) RETURNING name, labels, value, updated_at
+	), rolled AS (
+		INSERT INTO counter_metrics_1m AS r (name, labels, bucket, value, count)
+		SELECT name, labels, updated_at - updated_at % $2, sum(value), count(*)
+		FROM moved GROUP BY name, labels, updated_at - updated_at % $2
+		ON CONFLICT (name, labels, bucket) DO UPDATE SET
+			value = r.value + excluded.value,
+			count = r.count + excluded.count
+	) SELECT count(*) FROM moved;`
+	compactMinuteGaugeMetricsQuery = `WITH moved AS (
+		DELETE FROM gauge_metrics_1m WHERE bucket < $1
+		RETURNING name, labels, bucket, avg, min, max, last, count
+	), rolled AS (
+		INSERT INTO gauge_metrics_1h AS r (name, labels, bucket, avg, min, max, last, count)
+		SELECT name, labels, bucket - bucket % $2, sum(avg * count) / sum(count), min(min), max(max),
+			(array_agg(last ORDER BY bucket DESC))[1], sum(count)
+		FROM moved GROUP BY name, labels, bucket - bucket % $2
+		ON CONFLICT (name, labels, bucket) DO UPDATE SET
+			avg = (r.avg * r.count + excluded.avg * excluded.count) / (r.count + excluded.count),
+			min = LEAST(r.min, excluded.min),
+			max = GREATEST(r.max, excluded.max),
+			last = excluded.last,
+			count = r.count + excluded.count
+	) SELECT count(*) FROM moved;`
+	compactMinuteCounterMetricsQuery = `WITH moved AS (
+		DELETE FROM counter_metrics_1m WHERE bucket < $1
+		RETURNING name, labels, bucket, value, count
+	), rolled AS (
+		INSERT INTO counter_metrics_1h AS r (name, labels, bucket, value, count)
+		SELECT name, labels, bucket - bucket % $2, sum(value), sum(count)
+		FROM moved GROUP BY name, labels, bucket - bucket % $2
+		ON CONFLICT (name, labels, bucket) DO UPDATE SET
+			value = r.value + excluded.value,
+			count = r.count + excluded.count
+	) SELECT count(*) FROM moved;`
+	expireHourGaugeMetricsQuery   = `DELETE FROM gauge_metrics_1h WHERE bucket < $1;`
+	expireHourCounterMetricsQuery = `WITH moved AS (
+		DELETE FROM counter_metrics_1h WHERE bucket < $1
+		RETURNING name, labels, value
+	), archived AS (
+		INSERT INTO counter_metrics_archive AS a (name, labels, value)
+		SELECT name, labels, sum(value) FROM moved GROUP BY name, labels
+		ON CONFLICT (name, labels) DO UPDATE SET value = a.value + excluded.value
+	) SELECT count(*) FROM moved;`
+
+	// A histogram is kept as a single row per series, every update is merged
+	// into it. The row is left untouched if the bucket boundaries differ.
+	getHistogramMetricQuery = `SELECT name, labels, buckets, counts, sum, count FROM histogram_metrics
+		WHERE name = $1 AND labels = $2;`
+	getHistogramMetricsQuery   = `SELECT name, labels, buckets, counts, sum, count FROM histogram_metrics;`
+	upsertHistogramMetricQuery = `INSERT INTO histogram_metrics AS h (name, labels, buckets, counts, sum, count, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (name, labels) DO UPDATE SET
+			counts = (
+				SELECT array_agg(c.cur + c.upd ORDER BY c.i)
+				FROM unnest(h.counts, excluded.counts) WITH ORDINALITY AS c(cur, upd, i)
+			),
+			sum = h.sum + excluded.sum,
+			count = h.count + excluded.count,
+			updated_at = excluded.updated_at
+		WHERE h.buckets = excluded.buckets;`
+
+	// Deleting a series removes its current value together with its history,
+	// the number of current rows deleted tells whether the series existed.
+	deleteGaugeMetricQuery = `WITH raw AS (
+		DELETE FROM gauge_metrics WHERE name = $1 AND labels = $2
+	), minute AS (
+		DELETE FROM gauge_metrics_1m WHERE name = $1 AND labels = $2
+	), hour AS (
+		DELETE FROM gauge_metrics_1h WHERE name = $1 AND labels = $2
+	) DELETE FROM gauge_metrics_current WHERE name = $1 AND labels = $2;`
+	deleteCounterMetricQuery = `WITH raw AS (
+		DELETE FROM counter_metrics WHERE name = $1 AND labels = $2
+	), minute AS (
+		DELETE FROM counter_metrics_1m WHERE name = $1 AND labels = $2
+	), hour AS (
+		DELETE FROM counter_metrics_1h WHERE name = $1 AND labels = $2
+	), archive AS (
+		DELETE FROM counter_metrics_archive WHERE name = $1 AND labels = $2
+	) DELETE FROM counter_metrics_current WHERE name = $1 AND labels = $2;`
+	deleteHistogramMetricQuery = `DELETE FROM histogram_metrics WHERE name = $1 AND labels = $2;`
+	// A reset keeps the history of the deltas, only the running sum restarts.
+	resetCounterMetricQuery = `UPDATE counter_metrics_current SET value = 0, updated_at = $3
+		WHERE name = $1 AND labels = $2;`
 )
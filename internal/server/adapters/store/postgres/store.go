@@ -2,11 +2,13 @@ package postgres
 
 import (
 	"context"
-	"time"
 
 	"github.com/VoevodinAnton/metrics/internal/server/models"
+	"github.com/VoevodinAnton/metrics/pkg/retry"
 
-	"github.com/jackc/pgtype"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
@@ -14,47 +16,77 @@ import (
 
 type Store struct {
 	db *pgxpool.Pool
+	// retrier repeats reads and gauge writes on transient failures.
+	retrier *retry.Retrier
+	// counterRetrier repeats counter writes only when the statement surely
+	// was not applied, so that a delta is never added twice.
+	counterRetrier *retry.Retrier
 }
 
 func NewStore(db *pgxpool.Pool) *Store {
 	return &Store{
-		db: db,
+		db:             db,
+		retrier:        retry.New(),
+		counterRetrier: retry.New(retry.WithClassifier(isNotApplied)),
 	}
 }
 
-func (s *Store) GetGaugeMetric(ctx context.Context, name string) (models.Metric, error) {
-	row := s.db.QueryRow(ctx, getGaugeMetricQuery, name)
+// isNotApplied reports whether the failed statement did not reach the database.
+func isNotApplied(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgerrcode.IsConnectionException(pgErr.Code) || pgErr.Code == pgerrcode.CannotConnectNow
+	}
+	return pgconn.SafeToRetry(err)
+}
+
+func (s *Store) GetGaugeMetric(ctx context.Context, name string, labels map[string]string) (models.Metric, error) {
 	var metric = models.Metric{
 		Type: models.Gauge,
 	}
-	err := row.Scan(&metric.Name, &metric.Value)
+	err := s.retrier.Do(ctx, func() error {
+		row := s.db.QueryRow(ctx, getGaugeMetricQuery, name, labelsOrEmpty(labels))
+		return row.Scan(&metric.Name, &metric.Labels, &metric.Value) //nolint: wrapcheck // wrapped below
+	})
 	if err != nil {
-		return models.Metric{}, errors.Wrap(err, "row.Scan gauge")
+		return models.Metric{}, errors.Wrap(notFound(err, name), "row.Scan gauge")
 	}
 
 	return metric, nil
 }
 
-func (s *Store) GetCounterMetric(ctx context.Context, name string) (models.Metric, error) {
-	row := s.db.QueryRow(ctx, getCounterMetricQuery, name)
+func (s *Store) GetCounterMetric(ctx context.Context, name string, labels map[string]string) (models.Metric, error) {
 	var metric = models.Metric{
 		Type: models.Counter,
 	}
-	var value pgtype.Numeric
-	err := row.Scan(&metric.Name, &value)
+	var value int64
+	err := s.retrier.Do(ctx, func() error {
+		row := s.db.QueryRow(ctx, getCounterMetricQuery, name, labelsOrEmpty(labels))
+		return row.Scan(&metric.Name, &metric.Labels, &value) //nolint: wrapcheck // wrapped below
+	})
 	if err != nil {
-		return models.Metric{}, errors.Wrap(err, "row.Scan counter")
+		return models.Metric{}, errors.Wrap(notFound(err, name), "row.Scan counter")
 	}
-	metric.Value = value.Int.Int64()
+	metric.Value = value
 
 	return metric, nil
 }
 
+// notFound reports a missing row as models.ErrMetricNotFound.
+func notFound(err error, name string) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errors.Wrap(models.ErrMetricNotFound, name)
+	}
+	return err
+}
+
 func (s *Store) PutCounterMetric(ctx context.Context, update models.Metric) error {
 	zap.L().Debug("store.postgres.putCounterMetric", zap.Reflect("counterMetricPut", update))
-	_, err := s.db.Exec(ctx, insertCounterMetricQuery, update.Name, update.Value, time.Now().UnixNano())
+	err := s.counterRetrier.Do(ctx, func() error {
+		return s.putMetrics(ctx, []models.Metric{update}, counterWrite)
+	})
 	if err != nil {
-		return errors.Wrap(err, "db.Exec counter")
+		return errors.Wrap(err, "putMetrics counter")
 	}
 
 	return nil
@@ -63,14 +95,18 @@ func (s *Store) PutCounterMetric(ctx context.Context, update models.Metric) erro
 func (s *Store) PutCounterMetrics(ctx context.Context, updates []models.Metric) error {
 	zap.L().Debug("store.postgres.putCounterMetrics", zap.Reflect("counterMetricsPut", updates))
 
-	return s.putMetrics(ctx, insertCounterMetricQueryName, insertCounterMetricQuery, updates)
+	return s.counterRetrier.Do(ctx, func() error {
+		return s.putMetrics(ctx, updates, counterWrite)
+	})
 }
 
 func (s *Store) PutGaugeMetric(ctx context.Context, update models.Metric) error {
 	zap.L().Debug("store.postgres.putGaugeMetric", zap.Reflect("gaugeMetricPut", update))
-	_, err := s.db.Exec(ctx, insertGaugeMetricQuery, update.Name, update.Value, time.Now().UnixNano())
+	err := s.retrier.Do(ctx, func() error {
+		return s.putMetrics(ctx, []models.Metric{update}, gaugeWrite)
+	})
 	if err != nil {
-		return errors.Wrap(err, "db.Exec gauge")
+		return errors.Wrap(err, "putMetrics gauge")
 	}
 
 	return nil
@@ -79,40 +115,30 @@ func (s *Store) PutGaugeMetric(ctx context.Context, update models.Metric) error
 func (s *Store) PutGaugeMetrics(ctx context.Context, updates []models.Metric) error {
 	zap.L().Debug("store.postgres.putGaugeMetrics", zap.Reflect("gaugeMetricsPut", updates))
 
-	return s.putMetrics(ctx, insertGaugeMetricQueryName, insertGaugeMetricQuery, updates)
-}
-
-func (s *Store) putMetrics(ctx context.Context, queryName, query string, updates []models.Metric) error {
-	tx, err := s.db.Begin(ctx)
-	if err != nil {
-		return errors.Wrap(err, "db.Begin")
-	}
-	defer func() {
-		_ = tx.Rollback(ctx)
-	}()
-	_, err = tx.Prepare(ctx, queryName, query)
-	if err != nil {
-		return errors.Wrap(err, "tx.Prepare")
-	}
-	for _, update := range updates {
-		_, err := tx.Exec(ctx, queryName, update.Name, update.Value, time.Now().UnixNano())
-		if err != nil {
-			return errors.Wrap(err, "tx.Exec")
-		}
-	}
-
-	return tx.Commit(ctx) //nolint: wrapcheck //unnecessary
+	return s.retrier.Do(ctx, func() error {
+		return s.putMetrics(ctx, updates, gaugeWrite)
+	})
 }
 
 func (s *Store) GetCounterMetrics(ctx context.Context) (map[string]models.Metric, error) {
-	return s.getMetrics(ctx, getCounterMetricsQuery)
+	return s.getMetrics(ctx, getCounterMetricsQuery, models.Counter)
 }
 
 func (s *Store) GetGaugeMetrics(ctx context.Context) (map[string]models.Metric, error) {
-	return s.getMetrics(ctx, getGaugeMetricsQuery)
+	return s.getMetrics(ctx, getGaugeMetricsQuery, models.Gauge)
 }
 
-func (s *Store) getMetrics(ctx context.Context, query string) (map[string]models.Metric, error) {
+func (s *Store) getMetrics(
+	ctx context.Context, query, mType string,
+) (metrics map[string]models.Metric, err error) {
+	err = s.retrier.Do(ctx, func() error {
+		metrics, err = s.queryMetrics(ctx, query, mType)
+		return err
+	})
+	return metrics, err
+}
+
+func (s *Store) queryMetrics(ctx context.Context, query, mType string) (map[string]models.Metric, error) {
 	rows, err := s.db.Query(ctx, query)
 	if err != nil {
 		return nil, errors.Wrap(err, "db.Query gauge")
@@ -121,16 +147,25 @@ func (s *Store) getMetrics(ctx context.Context, query string) (map[string]models
 
 	metrics := make(map[string]models.Metric, 0)
 	for rows.Next() {
-		var metric models.Metric
-		if err := rows.Scan(&metric.Name, &metric.Value); err != nil {
+		metric := models.Metric{Type: mType}
+		if err := rows.Scan(&metric.Name, &metric.Labels, &metric.Value); err != nil {
 			return nil, errors.Wrap(err, "rows.Scan geuge")
 		}
-		metrics[metric.Name] = metric
+		metrics[metric.Key()] = metric
 	}
 
 	return metrics, nil
 }
 
+// labelsOrEmpty replaces nil labels with an empty set so that the series
+// identity matches the labels column default.
+func labelsOrEmpty(labels map[string]string) map[string]string {
+	if labels == nil {
+		return map[string]string{}
+	}
+	return labels
+}
+
 func (s *Store) Ping(ctx context.Context) error {
 	return errors.Wrap(s.db.Ping(ctx), "db.Ping")
 }
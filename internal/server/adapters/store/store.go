@@ -3,8 +3,10 @@ package store
 import (
 	"context"
 
+	"github.com/VoevodinAnton/metrics/internal/server/adapters/store/bolt"
 	"github.com/VoevodinAnton/metrics/internal/server/adapters/store/memory"
 	pg_store "github.com/VoevodinAnton/metrics/internal/server/adapters/store/postgres"
+	"github.com/VoevodinAnton/metrics/internal/server/adapters/store/wal"
 	"github.com/VoevodinAnton/metrics/internal/server/config"
 	"github.com/VoevodinAnton/metrics/internal/server/models"
 	"github.com/VoevodinAnton/metrics/pkg/postgres"
@@ -12,26 +14,68 @@ import (
 )
 
 type Store interface {
-	GetGaugeMetric(ctx context.Context, name string) (models.Metric, error)
-	GetCounterMetric(ctx context.Context, name string) (models.Metric, error)
+	GetGaugeMetric(ctx context.Context, name string, labels map[string]string) (models.Metric, error)
+	GetCounterMetric(ctx context.Context, name string, labels map[string]string) (models.Metric, error)
+	GetHistogramMetric(ctx context.Context, name string, labels map[string]string) (models.Metric, error)
 	PutCounterMetric(ctx context.Context, update models.Metric) error
 	PutGaugeMetric(ctx context.Context, update models.Metric) error
+	PutHistogramMetric(ctx context.Context, update models.Metric) error
 	GetCounterMetrics(ctx context.Context) (map[string]models.Metric, error)
 	GetGaugeMetrics(ctx context.Context) (map[string]models.Metric, error)
+	GetHistogramMetrics(ctx context.Context) (map[string]models.Metric, error)
 	PutCounterMetrics(ctx context.Context, updates []models.Metric) error
 	PutGaugeMetrics(ctx context.Context, updates []models.Metric) error
+	PutHistogramMetrics(ctx context.Context, updates []models.Metric) error
+	DeleteMetrics(ctx context.Context, metrics []models.Metric) (int, error)
+	ResetCounterMetrics(ctx context.Context, metrics []models.Metric) (int, error)
+	GetGaugeHistory(ctx context.Context, query models.HistoryQuery) ([]models.HistoryPoint, error)
+	GetCounterHistory(ctx context.Context, query models.HistoryQuery) ([]models.HistoryPoint, error)
 	Ping(ctx context.Context) error
 	Close()
 }
 
+const (
+	EngineMemory   = "memory"
+	EnginePostgres = "postgres"
+	EngineWAL      = "wal"
+	EngineBolt     = "bolt"
+)
+
+var ErrUnknownEngine = errors.New("unknown store engine")
+
+// NewStore creates the engine selected by cfg.Storage.Engine. Without one it
+// picks postgres if the DSN is set and memory otherwise.
 func NewStore(cfg *config.Config) (Store, error) {
-	if cfg.Postgres.DatabaseDSN != "" {
+	engine := cfg.Storage.Engine
+	if engine == "" {
+		engine = EngineMemory
+		if cfg.Postgres.DatabaseDSN != "" {
+			engine = EnginePostgres
+		}
+	}
+
+	switch engine {
+	case EngineMemory:
+		return memory.NewStorage(), nil
+	case EnginePostgres:
 		db, err := postgres.NewPgxConn(context.Background(), cfg.Postgres)
 		if err != nil {
 			return nil, errors.Wrap(err, "postgres.NewPgxConn")
 		}
 		return pg_store.NewStore(db), nil
-	} else {
-		return memory.NewStorage(), nil
+	case EngineWAL:
+		s, err := wal.NewStore(cfg.Storage)
+		if err != nil {
+			return nil, errors.Wrap(err, "wal.NewStore")
+		}
+		return s, nil
+	case EngineBolt:
+		s, err := bolt.NewStore(cfg.Storage)
+		if err != nil {
+			return nil, errors.Wrap(err, "bolt.NewStore")
+		}
+		return s, nil
+	default:
+		return nil, errors.Wrap(ErrUnknownEngine, engine)
 	}
 }
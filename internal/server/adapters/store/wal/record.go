@@ -0,0 +1,270 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"math"
+
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+	"github.com/pkg/errors"
+)
+
+// A record is framed as a big-endian uint32 payload length, the CRC-32C of
+// the payload and the payload itself. The payload starts with the operation:
+// a batch of updates of one metric type, a batch of series to delete or of
+// counters to reset, or the checkpoint header.
+const (
+	recordHeaderSize = 8
+	maxRecordSize    = 64 << 20
+
+	opCounter    byte = 1
+	opGauge      byte = 2
+	opHistogram  byte = 3
+	opCheckpoint byte = 4
+	opDelete     byte = 5
+	opReset      byte = 6
+)
+
+var (
+	ErrCorruptRecord  = errors.New("corrupt record")
+	ErrRecordTooLarge = errors.New("record too large")
+	// errTornRecord is a record cut short by a crash in the middle of a write.
+	errTornRecord = errors.New("torn record")
+
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+func appendRecord(dst, payload []byte) []byte {
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(payload)))
+	dst = binary.BigEndian.AppendUint32(dst, crc32.Checksum(payload, crcTable))
+	return append(dst, payload...)
+}
+
+// appendBatch appends the updates as records whose payload is at most
+// maxSize, the size readRecord accepts. A batch too large for one record is
+// split in halves, so a crash while it is written may leave only the first
+// records in the log. A single update that does not fit is rejected.
+func appendBatch(dst []byte, op byte, updates []models.Metric, maxSize int) ([]byte, error) {
+	payload, err := encodeBatch(op, updates)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) <= maxSize {
+		return appendRecord(dst, payload), nil
+	}
+	if len(updates) <= 1 {
+		return nil, errors.Wrapf(ErrRecordTooLarge, "%d bytes", len(payload))
+	}
+	half := len(updates) / 2
+	dst, err = appendBatch(dst, op, updates[:half], maxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return appendBatch(dst, op, updates[half:], maxSize)
+}
+
+// readRecord returns the next payload, io.EOF at the end of the log.
+func readRecord(r *bufio.Reader) ([]byte, error) {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, errTornRecord
+		}
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:4])
+	if size > maxRecordSize {
+		return nil, errors.Wrapf(ErrCorruptRecord, "record size %d", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, errTornRecord
+		}
+		return nil, errors.Wrap(err, "io.ReadFull")
+	}
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, errors.Wrap(ErrCorruptRecord, "checksum mismatch")
+	}
+
+	return payload, nil
+}
+
+func encodeBatch(op byte, updates []models.Metric) ([]byte, error) {
+	buf := []byte{op}
+	buf = binary.AppendUvarint(buf, uint64(len(updates)))
+	for _, m := range updates {
+		buf = appendString(buf, m.Name)
+		buf = binary.AppendUvarint(buf, uint64(len(m.Labels)))
+		for k, v := range m.Labels {
+			buf = appendString(appendString(buf, k), v)
+		}
+		switch op {
+		case opCounter:
+			v, ok := m.Value.(int64)
+			if !ok {
+				return nil, errors.New("expected int64 type")
+			}
+			buf = binary.AppendVarint(buf, v)
+		case opGauge:
+			v, ok := m.Value.(float64)
+			if !ok {
+				return nil, errors.New("expected float64 type")
+			}
+			buf = appendFloat(buf, v)
+		case opHistogram:
+			h, ok := m.Value.(models.HistogramValue)
+			if !ok {
+				return nil, errors.New("expected histogram type")
+			}
+			buf = binary.AppendUvarint(buf, uint64(len(h.Buckets)))
+			for _, b := range h.Buckets {
+				buf = appendFloat(buf, b)
+			}
+			buf = binary.AppendUvarint(buf, uint64(len(h.Counts)))
+			for _, c := range h.Counts {
+				buf = binary.AppendUvarint(buf, c)
+			}
+			buf = appendFloat(buf, h.Sum)
+			buf = binary.AppendUvarint(buf, h.Count)
+		case opDelete:
+			buf = appendString(buf, m.Type)
+		}
+	}
+
+	return buf, nil
+}
+
+func decodeBatch(payload []byte) (byte, []models.Metric, error) {
+	d := decoder{buf: payload}
+	op := d.byte()
+	n := d.length()
+	updates := make([]models.Metric, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		m := models.Metric{Name: d.string()}
+		if labels := d.length(); labels > 0 {
+			m.Labels = make(map[string]string, labels)
+			for j := 0; j < labels && d.err == nil; j++ {
+				k := d.string()
+				m.Labels[k] = d.string()
+			}
+		}
+		switch op {
+		case opCounter:
+			m.Type = models.Counter
+			m.Value = d.varint()
+		case opGauge:
+			m.Type = models.Gauge
+			m.Value = d.float()
+		case opHistogram:
+			var h models.HistogramValue
+			h.Buckets = make([]float64, d.length())
+			for j := range h.Buckets {
+				h.Buckets[j] = d.float()
+			}
+			h.Counts = make([]uint64, d.length())
+			for j := range h.Counts {
+				h.Counts[j] = d.uvarint()
+			}
+			h.Sum = d.float()
+			h.Count = d.uvarint()
+			m.Type = models.Histogram
+			m.Value = h
+		case opDelete:
+			m.Type = d.string()
+		case opReset:
+			m.Type = models.Counter
+		default:
+			return 0, nil, errors.Wrapf(ErrCorruptRecord, "unknown operation %d", op)
+		}
+		updates = append(updates, m)
+	}
+	if d.err != nil {
+		return 0, nil, d.err
+	}
+
+	return op, updates, nil
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendFloat(buf []byte, f float64) []byte {
+	return binary.BigEndian.AppendUint64(buf, math.Float64bits(f))
+}
+
+// decoder reads the payload fields, the first malformed one sets err and
+// the following reads return zero values.
+type decoder struct {
+	err error
+	buf []byte
+}
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = errors.Wrap(ErrCorruptRecord, "truncated payload")
+	}
+	d.buf = nil
+}
+
+func (d *decoder) byte() byte {
+	if len(d.buf) < 1 {
+		d.fail()
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+// length reads a count of elements, each of them takes at least a byte.
+func (d *decoder) length() int {
+	n := d.uvarint()
+	if n > uint64(len(d.buf)) {
+		d.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) float() float64 {
+	if len(d.buf) < 8 {
+		d.fail()
+		return 0
+	}
+	v := math.Float64frombits(binary.BigEndian.Uint64(d.buf))
+	d.buf = d.buf[8:]
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.length()
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
@@ -0,0 +1,461 @@
+package wal
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VoevodinAnton/metrics/internal/server/adapters/store/memory"
+	"github.com/VoevodinAnton/metrics/internal/server/config"
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	checkpointFile = "checkpoint"
+	logPrefix      = "wal-"
+	logSuffix      = ".log"
+	filePerm       = 0600
+	dirPerm        = 0700
+)
+
+// Store keeps the metrics in memory and appends every Put call to a
+// write-ahead log before applying it, so that the state survives a restart.
+//
+// The log is split into generations. A checkpoint of generation g holds
+// the state produced by the logs before g, so on startup the checkpoint is
+// loaded and the logs from g on are replayed. The records are written
+// without fsync: a crash of the process loses nothing, a crash of the host
+// may lose the updates since the last checkpoint.
+type Store struct {
+	*memory.Store
+	cfg  *config.Storage
+	file *os.File
+	stop chan struct{}
+	gen  uint64
+	// mu serializes the writes, so that the log has them in the order
+	// they are applied, and the checkpoints.
+	mu sync.Mutex
+	wg sync.WaitGroup
+}
+
+func NewStore(cfg *config.Storage) (*Store, error) {
+	if err := os.MkdirAll(cfg.Path, dirPerm); err != nil {
+		return nil, errors.Wrap(err, "os.MkdirAll")
+	}
+	s := &Store{
+		Store: memory.NewStorage(),
+		cfg:   cfg,
+		stop:  make(chan struct{}),
+	}
+	if err := s.recover(); err != nil {
+		return nil, err
+	}
+
+	if cfg.CheckpointInterval > 0 {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.runCheckpoints()
+		}()
+	}
+
+	return s, nil
+}
+
+func (s *Store) PutCounterMetric(ctx context.Context, update models.Metric) error {
+	return s.write(opCounter, []models.Metric{update}, func() error {
+		return s.Store.PutCounterMetric(ctx, update)
+	})
+}
+
+func (s *Store) PutCounterMetrics(ctx context.Context, updates []models.Metric) error {
+	return s.write(opCounter, updates, func() error {
+		return s.Store.PutCounterMetrics(ctx, updates)
+	})
+}
+
+func (s *Store) PutGaugeMetric(ctx context.Context, update models.Metric) error {
+	return s.write(opGauge, []models.Metric{update}, func() error {
+		return s.Store.PutGaugeMetric(ctx, update)
+	})
+}
+
+func (s *Store) PutGaugeMetrics(ctx context.Context, updates []models.Metric) error {
+	return s.write(opGauge, updates, func() error {
+		return s.Store.PutGaugeMetrics(ctx, updates)
+	})
+}
+
+func (s *Store) PutHistogramMetric(ctx context.Context, update models.Metric) error {
+	return s.write(opHistogram, []models.Metric{update}, func() error {
+		return s.Store.PutHistogramMetric(ctx, update)
+	})
+}
+
+func (s *Store) PutHistogramMetrics(ctx context.Context, updates []models.Metric) error {
+	return s.write(opHistogram, updates, func() error {
+		return s.Store.PutHistogramMetrics(ctx, updates)
+	})
+}
+
+func (s *Store) DeleteMetrics(ctx context.Context, metrics []models.Metric) (deleted int, err error) {
+	err = s.write(opDelete, metrics, func() error {
+		deleted, err = s.Store.DeleteMetrics(ctx, metrics)
+		return err
+	})
+	return deleted, err
+}
+
+func (s *Store) ResetCounterMetrics(ctx context.Context, metrics []models.Metric) (reset int, err error) {
+	err = s.write(opReset, metrics, func() error {
+		reset, err = s.Store.ResetCounterMetrics(ctx, metrics)
+		return err
+	})
+	return reset, err
+}
+
+// write logs the updates and applies them. The record is written before the
+// memory store is changed, an update the store rejects is rejected again on
+// replay.
+func (s *Store) write(op byte, updates []models.Metric, apply func() error) error {
+	record, err := appendBatch(nil, op, updates, maxRecordSize)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return errors.New("store is closed")
+	}
+	if _, err := s.file.Write(record); err != nil {
+		return errors.Wrap(err, "wal.Write")
+	}
+
+	return apply()
+}
+
+// Durable reports that the store recovers the metrics on its own.
+func (s *Store) Durable() bool {
+	return true
+}
+
+// Checkpoint writes the state to the checkpoint of the next generation and
+// starts its log. The older logs are removed.
+func (s *Store) Checkpoint(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return errors.New("store is closed")
+	}
+
+	next := s.gen + 1
+	file, err := os.OpenFile(s.logPath(next), os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, filePerm)
+	if err != nil {
+		return errors.Wrap(err, "os.OpenFile")
+	}
+	if err := s.writeCheckpoint(ctx, next); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	if err := s.file.Close(); err != nil {
+		zap.L().Error("wal.Close", zap.Error(err))
+	}
+	s.file = file
+	s.gen = next
+	s.removeLogsBefore(next)
+
+	return nil
+}
+
+func (s *Store) writeCheckpoint(ctx context.Context, gen uint64) error {
+	buf := appendRecord(nil, binary.AppendUvarint([]byte{opCheckpoint}, gen))
+	for _, kind := range []struct {
+		get func(ctx context.Context) (map[string]models.Metric, error)
+		op  byte
+	}{
+		{get: s.Store.GetCounterMetrics, op: opCounter},
+		{get: s.Store.GetGaugeMetrics, op: opGauge},
+		{get: s.Store.GetHistogramMetrics, op: opHistogram},
+	} {
+		metrics, err := kind.get(ctx)
+		if err != nil {
+			return err
+		}
+		if len(metrics) == 0 {
+			continue
+		}
+		updates := make([]models.Metric, 0, len(metrics))
+		for _, m := range metrics {
+			updates = append(updates, m)
+		}
+		buf, err = appendBatch(buf, kind.op, updates, maxRecordSize)
+		if err != nil {
+			return err
+		}
+	}
+
+	tmp, err := os.CreateTemp(s.cfg.Path, checkpointFile+".tmp*")
+	if err != nil {
+		return errors.Wrap(err, "os.CreateTemp")
+	}
+	_, err = tmp.Write(buf)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(s.cfg.Path, checkpointFile))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return errors.Wrap(err, "write checkpoint")
+	}
+
+	return syncDir(s.cfg.Path)
+}
+
+// Close checkpoints the state, so that the next start does not replay the
+// log, and closes the log.
+func (s *Store) Close() {
+	close(s.stop)
+	s.wg.Wait()
+	if err := s.Checkpoint(context.Background()); err != nil {
+		zap.L().Error("wal.Checkpoint", zap.Error(err))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.file.Sync(); err != nil {
+		zap.L().Error("wal.Sync", zap.Error(err))
+	}
+	if err := s.file.Close(); err != nil {
+		zap.L().Error("wal.Close", zap.Error(err))
+	}
+	s.file = nil
+}
+
+func (s *Store) runCheckpoints() {
+	ticker := time.NewTicker(s.cfg.CheckpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		if err := s.Checkpoint(context.Background()); err != nil {
+			zap.L().Error("wal.Checkpoint", zap.Error(err))
+		}
+	}
+}
+
+// recover loads the checkpoint, replays the logs written after it and
+// opens the last one for appending.
+func (s *Store) recover() error {
+	gen, err := s.loadCheckpoint()
+	if err != nil {
+		return err
+	}
+	s.gen = gen
+
+	gens, err := s.logGenerations()
+	if err != nil {
+		return err
+	}
+	var validSize int64
+	for _, g := range gens {
+		if g < gen {
+			continue
+		}
+		size, err := s.replay(s.logPath(g))
+		if err != nil {
+			return err
+		}
+		s.gen, validSize = g, size
+	}
+
+	file, err := os.OpenFile(s.logPath(s.gen), os.O_CREATE|os.O_WRONLY|os.O_APPEND, filePerm)
+	if err != nil {
+		return errors.Wrap(err, "os.OpenFile")
+	}
+	// drop a torn record, the next ones would be unreachable behind it
+	if err := file.Truncate(validSize); err != nil {
+		_ = file.Close()
+		return errors.Wrap(err, "file.Truncate")
+	}
+	s.file = file
+	s.removeLogsBefore(gen)
+
+	return nil
+}
+
+func (s *Store) loadCheckpoint() (uint64, error) {
+	file, err := os.Open(filepath.Join(s.cfg.Path, checkpointFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, errors.Wrap(err, "os.Open")
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			zap.L().Error("file.Close", zap.Error(err))
+		}
+	}()
+
+	r := bufio.NewReader(file)
+	payload, err := readRecord(r)
+	if err != nil {
+		return 0, errors.Wrap(err, "checkpoint header")
+	}
+	if len(payload) == 0 || payload[0] != opCheckpoint {
+		return 0, errors.Wrap(ErrCorruptRecord, "checkpoint header")
+	}
+	gen, n := binary.Uvarint(payload[1:])
+	if n <= 0 {
+		return 0, errors.Wrap(ErrCorruptRecord, "checkpoint header")
+	}
+	for {
+		payload, err := readRecord(r)
+		if errors.Is(err, io.EOF) {
+			return gen, nil
+		}
+		if err != nil {
+			return 0, errors.Wrap(err, "checkpoint")
+		}
+		if err := s.apply(payload); err != nil {
+			return 0, errors.Wrap(err, "checkpoint")
+		}
+	}
+}
+
+// replay applies the records of the log and returns the size of its valid
+// part. The log ends at the first torn or corrupt record.
+func (s *Store) replay(path string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, errors.Wrap(err, "os.Open")
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			zap.L().Error("file.Close", zap.Error(err))
+		}
+	}()
+
+	r := bufio.NewReader(file)
+	var size int64
+	for {
+		payload, err := readRecord(r)
+		if errors.Is(err, io.EOF) {
+			return size, nil
+		}
+		if err != nil {
+			zap.L().Warn("write-ahead log ends with a damaged record",
+				zap.String("path", path), zap.Int64("offset", size), zap.Error(err))
+			return size, nil
+		}
+		if err := s.apply(payload); err != nil {
+			zap.L().Warn("replay", zap.String("path", path), zap.Int64("offset", size), zap.Error(err))
+		}
+		size += int64(recordHeaderSize + len(payload))
+	}
+}
+
+func (s *Store) apply(payload []byte) error {
+	op, updates, err := decodeBatch(payload)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	switch op {
+	case opCounter:
+		return s.Store.PutCounterMetrics(ctx, updates)
+	case opGauge:
+		return s.Store.PutGaugeMetrics(ctx, updates)
+	case opDelete:
+		_, err = s.Store.DeleteMetrics(ctx, updates)
+		return err
+	case opReset:
+		_, err = s.Store.ResetCounterMetrics(ctx, updates)
+		return err
+	default:
+		return s.Store.PutHistogramMetrics(ctx, updates)
+	}
+}
+
+func (s *Store) logPath(gen uint64) string {
+	return filepath.Join(s.cfg.Path, fmt.Sprintf("%s%020d%s", logPrefix, gen, logSuffix))
+}
+
+// logGenerations returns the generations of the logs in ascending order.
+func (s *Store) logGenerations() ([]uint64, error) {
+	entries, err := os.ReadDir(s.cfg.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "os.ReadDir")
+	}
+	var gens []uint64
+	for _, e := range entries {
+		name, ok := strings.CutPrefix(e.Name(), logPrefix)
+		if !ok {
+			continue
+		}
+		name, ok = strings.CutSuffix(name, logSuffix)
+		if !ok {
+			continue
+		}
+		gen, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		gens = append(gens, gen)
+	}
+	sort.Slice(gens, func(i, j int) bool { return gens[i] < gens[j] })
+
+	return gens, nil
+}
+
+func (s *Store) removeLogsBefore(gen uint64) {
+	gens, err := s.logGenerations()
+	if err != nil {
+		zap.L().Error("logGenerations", zap.Error(err))
+		return
+	}
+	for _, g := range gens {
+		if g >= gen {
+			break
+		}
+		if err := os.Remove(s.logPath(g)); err != nil {
+			zap.L().Error("os.Remove", zap.Error(err))
+		}
+	}
+}
+
+// syncDir makes the rename of the checkpoint durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return errors.Wrap(err, "os.Open")
+	}
+	defer func() {
+		if err := d.Close(); err != nil {
+			zap.L().Error("dir.Close", zap.Error(err))
+		}
+	}()
+
+	return errors.Wrap(d.Sync(), "dir.Sync")
+}
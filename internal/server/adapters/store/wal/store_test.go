@@ -0,0 +1,149 @@
+package wal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/VoevodinAnton/metrics/internal/server/config"
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecord_roundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		updates []models.Metric
+		op      byte
+	}{
+		{
+			name: "counters",
+			op:   opCounter,
+			updates: []models.Metric{
+				{Name: "PollCount", Type: models.Counter, Value: int64(-3)},
+				{Name: "requests", Type: models.Counter, Value: int64(1 << 40), Labels: map[string]string{"host": "a"}},
+			},
+		},
+		{
+			name:    "gauges",
+			op:      opGauge,
+			updates: []models.Metric{{Name: "Alloc", Type: models.Gauge, Value: 1.25}},
+		},
+		{
+			name: "histograms",
+			op:   opHistogram,
+			updates: []models.Metric{{Name: "latency", Type: models.Histogram, Value: models.HistogramValue{
+				Buckets: []float64{1, 5}, Counts: []uint64{2, 0, 1}, Sum: 9.5, Count: 3,
+			}}},
+		},
+		{
+			name: "deletes",
+			op:   opDelete,
+			updates: []models.Metric{
+				{Name: "Alloc", Type: models.Gauge},
+				{Name: "latency", Type: models.Histogram, Labels: map[string]string{"host": "a"}},
+			},
+		},
+		{
+			name:    "resets",
+			op:      opReset,
+			updates: []models.Metric{{Name: "PollCount", Type: models.Counter}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := encodeBatch(tt.op, tt.updates)
+			require.NoError(t, err)
+			op, got, err := decodeBatch(payload)
+			require.NoError(t, err)
+			assert.Equal(t, tt.op, op)
+			assert.Equal(t, tt.updates, got)
+
+			_, _, err = decodeBatch(payload[:len(payload)-1])
+			assert.ErrorIs(t, err, ErrCorruptRecord)
+		})
+	}
+}
+
+func TestStore_recover(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Storage{Path: t.TempDir()}
+
+	s, err := NewStore(cfg)
+	require.NoError(t, err)
+	require.NoError(t, s.PutCounterMetric(ctx, models.Metric{Name: "PollCount", Type: models.Counter, Value: int64(2)}))
+	require.NoError(t, s.PutGaugeMetrics(ctx, []models.Metric{{Name: "Alloc", Type: models.Gauge, Value: 1.5}}))
+	require.NoError(t, s.Checkpoint(ctx))
+	require.NoError(t, s.PutCounterMetric(ctx, models.Metric{Name: "PollCount", Type: models.Counter, Value: int64(3)}))
+	deleted, err := s.DeleteMetrics(ctx, []models.Metric{{Name: "Alloc", Type: models.Gauge}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	// the process dies in the middle of a write
+	_, err = s.file.Write(appendRecord(nil, []byte{opGauge, 1, 2, 3})[:6])
+	require.NoError(t, err)
+
+	recovered, err := NewStore(cfg)
+	require.NoError(t, err)
+	counter, err := recovered.GetCounterMetric(ctx, "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counter.Value)
+	_, err = recovered.GetGaugeMetric(ctx, "Alloc", nil)
+	assert.Error(t, err, "the checkpointed gauge is deleted by the log")
+
+	// the torn record is dropped, so the updates after it are replayed
+	require.NoError(t, recovered.PutCounterMetric(ctx, models.Metric{Name: "PollCount", Type: models.Counter, Value: int64(1)}))
+	recovered.Close()
+
+	entries, err := os.ReadDir(cfg.Path)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "checkpoint and the empty log of its generation")
+
+	reopened, err := NewStore(cfg)
+	require.NoError(t, err)
+	defer reopened.Close()
+	counter, err = reopened.GetCounterMetric(ctx, "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), counter.Value)
+}
+
+func TestAppendBatch(t *testing.T) {
+	updates := make([]models.Metric, 10)
+	for i := range updates {
+		updates[i] = models.Metric{Name: fmt.Sprintf("Gauge%d", i), Type: models.Gauge, Value: float64(i)}
+	}
+	single, err := encodeBatch(opGauge, updates[:1])
+	require.NoError(t, err)
+	maxSize := 3 * len(single)
+
+	buf, err := appendBatch(nil, opGauge, updates, maxSize)
+	require.NoError(t, err)
+
+	// every record is readable and the records hold the whole batch
+	r := bufio.NewReader(bytes.NewReader(buf))
+	var got []models.Metric
+	records := 0
+	for {
+		payload, err := readRecord(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(payload), maxSize)
+		_, batch, err := decodeBatch(payload)
+		require.NoError(t, err)
+		got = append(got, batch...)
+		records++
+	}
+	assert.Greater(t, records, 1)
+	assert.Equal(t, updates, got)
+
+	_, err = appendBatch(nil, opGauge, updates[:1], len(single)-1)
+	assert.ErrorIs(t, err, ErrRecordTooLarge)
+}
@@ -19,7 +19,11 @@ func init() {
 }
 
 const (
-	defaultStoreInterval = 300
+	defaultStoreInterval       = 300
+	defaultStatsDFlushInterval = 10
+	defaultBackupKeep          = 3
+	defaultCheckpointInterval  = 60
+	defaultBufferFlushInterval = 1
 
 	configPathEnv      = "CONFIG_PATH"
 	serverAddressEnv   = "ADDRESS"
@@ -27,17 +31,71 @@ const (
 	fileStoragePassEnv = "FILE_STORAGE_PATH"
 	restoreEnv         = "RESTORE"
 	databaseDSNEnv     = "DATABASE_DSN"
+	grpcAddressEnv     = "GRPC_ADDRESS"
+	keyEnv             = "KEY"
+	cryptoKeyEnv       = "CRYPTO_KEY"
+	statsDAddressEnv   = "STATSD_ADDRESS"
+	statsDFlushEnv     = "STATSD_FLUSH_INTERVAL"
+	backupKeepEnv      = "BACKUP_KEEP"
+	storageEngineEnv   = "STORAGE_ENGINE"
+	storagePathEnv     = "STORAGE_PATH"
+	checkpointEnv      = "STORAGE_CHECKPOINT_INTERVAL"
+	bufferSizeEnv      = "BUFFER_SIZE"
+	bufferFlushEnv     = "BUFFER_FLUSH_INTERVAL"
 
 	yaml = "yaml"
 )
 
+var ErrInvalidRetention = errors.New("invalid retention policy")
+
 type Config struct {
 	Logger        *config.Logger `mapstructure:"logger"`
+	Retention     *Retention     `mapstructure:"retention"`
 	Postgres      *config.Postgres
 	Server        *config.Server
+	GRPC          *config.GRPC
+	StatsD        *StatsD
+	Storage       *Storage
+	Buffer        *Buffer
 	FilePath      string
+	Key           string
+	CryptoKey     string
 	StoreInterval time.Duration
-	Restore       bool
+	// BackupKeep is the number of previous snapshots kept next to FilePath.
+	BackupKeep int
+	Restore    bool
+}
+
+// Retention configures the compaction of the postgres metric tables.
+// The job is disabled if Interval is zero.
+type Retention struct {
+	Interval time.Duration `mapstructure:"interval"`
+	Raw      time.Duration `mapstructure:"raw"`
+	Minute   time.Duration `mapstructure:"minute"`
+	Hour     time.Duration `mapstructure:"hour"`
+}
+
+// StatsD configures the UDP listener for StatsD lines, it is disabled
+// if Address is empty.
+type StatsD struct {
+	Address       string
+	FlushInterval time.Duration
+}
+
+// Storage selects the store engine. An empty Engine picks postgres if the
+// DSN is set and memory otherwise. Path and CheckpointInterval configure
+// the engines that keep their data on disk.
+type Storage struct {
+	Engine             string
+	Path               string
+	CheckpointInterval time.Duration
+}
+
+// Buffer configures the write-behind buffer of the gauge and counter
+// updates, it is disabled if Size is zero.
+type Buffer struct {
+	Size          int
+	FlushInterval time.Duration
 }
 
 func InitConfig() (*Config, error) {
@@ -66,24 +124,70 @@ func InitConfig() (*Config, error) {
 	if err := viper.Unmarshal(cfg); err != nil {
 		return nil, errors.Wrap(err, "viper.Unmarshal")
 	}
+	if cfg.Retention == nil {
+		cfg.Retention = &Retention{}
+	}
+	if cfg.Retention.Interval > 0 {
+		r := cfg.Retention
+		if r.Raw <= 0 || r.Minute < r.Raw || r.Hour < r.Minute {
+			return nil, errors.Wrap(ErrInvalidRetention, "expected 0 < raw <= minute <= hour")
+		}
+	}
 
 	var serverAddress string
 	var storeInterval int
 	var restore bool
 	var filePath string
 	var databaseDSN string
+	var grpcAddress string
+	var key string
+	var cryptoKey string
+	var statsDAddress string
+	var statsDFlushInterval int
+	var backupKeep int
+	var storageEngine string
+	var storagePath string
+	var checkpointInterval int
+	var bufferSize int
+	var bufferFlushInterval int
 
 	envServerAddress := os.Getenv(serverAddressEnv)
 	envStoreInterval := os.Getenv(storeIntervalEnv)
 	envFilePath := os.Getenv(fileStoragePassEnv)
 	envRestore := os.Getenv(restoreEnv)
 	envDatabaseDSN := os.Getenv(databaseDSNEnv)
+	envGRPCAddress := os.Getenv(grpcAddressEnv)
+	envKey := os.Getenv(keyEnv)
+	envCryptoKey := os.Getenv(cryptoKeyEnv)
+	envStatsDAddress := os.Getenv(statsDAddressEnv)
+	envStatsDFlushInterval := os.Getenv(statsDFlushEnv)
+	envBackupKeep := os.Getenv(backupKeepEnv)
+	envStorageEngine := os.Getenv(storageEngineEnv)
+	envStoragePath := os.Getenv(storagePathEnv)
+	envCheckpointInterval := os.Getenv(checkpointEnv)
+	envBufferSize := os.Getenv(bufferSizeEnv)
+	envBufferFlushInterval := os.Getenv(bufferFlushEnv)
 
 	flag.StringVar(&serverAddress, "a", "localhost:8080", "HTTP server endpoint address")
-	flag.IntVar(&storeInterval, "i", defaultStoreInterval, "Interval in seconds to save metrics to disk")
+	flag.IntVar(&storeInterval, "i", defaultStoreInterval, "Interval in seconds to save metrics to disk, 0 writes every update synchronously")
 	flag.StringVar(&filePath, "f", "/tmp/metrics-db.json", "Path to file where metrics are saved")
 	flag.BoolVar(&restore, "r", true, "Restore metrics from file on start")
+	flag.IntVar(&backupKeep, "backup-keep", defaultBackupKeep, "Number of previous snapshots to keep next to the file")
 	flag.StringVar(&databaseDSN, "d", "", "Connection string to postgres")
+	flag.StringVar(&storageEngine, "storage", "", "Store engine: memory, postgres, wal or bolt, by default postgres if -d is set")
+	flag.StringVar(&storagePath, "storage-path", "/tmp/metrics-storage", "Directory of the on-disk store engines")
+	flag.IntVar(&checkpointInterval, "checkpoint", defaultCheckpointInterval,
+		"Interval in seconds to checkpoint the on-disk store engines, 0 checkpoints only on shutdown")
+	flag.StringVar(&grpcAddress, "g", "", "gRPC server endpoint address, gRPC is disabled if empty")
+	flag.StringVar(&key, "k", "", "Key to sign requests and responses with HMAC-SHA256")
+	flag.StringVar(&cryptoKey, "crypto-key", "", "Path to RSA private key to decrypt agent requests")
+	flag.StringVar(&statsDAddress, "statsd", "", "UDP address to receive StatsD lines on, e.g. :8125, StatsD is disabled if empty")
+	flag.IntVar(&statsDFlushInterval, "statsd-flush", defaultStatsDFlushInterval,
+		"Interval in seconds to aggregate StatsD lines before writing them to the store")
+	flag.IntVar(&bufferSize, "buffer-size", 0,
+		"Number of series to buffer before writing them to the store, the buffer is disabled if 0")
+	flag.IntVar(&bufferFlushInterval, "buffer-flush", defaultBufferFlushInterval,
+		"Interval in seconds to write the buffered updates to the store")
 	flag.Parse()
 
 	if envServerAddress != "" {
@@ -98,16 +202,77 @@ func InitConfig() (*Config, error) {
 	if envRestore != "" {
 		restore, _ = strconv.ParseBool(envRestore)
 	}
+	if envBackupKeep != "" {
+		backupKeep, _ = strconv.Atoi(envBackupKeep)
+	}
+	if backupKeep < 0 {
+		backupKeep = 0
+	}
 	if envDatabaseDSN != "" {
 		databaseDSN = envDatabaseDSN
 	}
+	if envStorageEngine != "" {
+		storageEngine = envStorageEngine
+	}
+	if envStoragePath != "" {
+		storagePath = envStoragePath
+	}
+	if envCheckpointInterval != "" {
+		checkpointInterval, _ = strconv.Atoi(envCheckpointInterval)
+	}
+	if envBufferSize != "" {
+		bufferSize, _ = strconv.Atoi(envBufferSize)
+	}
+	if envBufferFlushInterval != "" {
+		bufferFlushInterval, _ = strconv.Atoi(envBufferFlushInterval)
+	}
+	if bufferFlushInterval <= 0 {
+		bufferFlushInterval = defaultBufferFlushInterval
+	}
+	if envGRPCAddress != "" {
+		grpcAddress = envGRPCAddress
+	}
+	if envKey != "" {
+		key = envKey
+	}
+	if envCryptoKey != "" {
+		cryptoKey = envCryptoKey
+	}
+	if envStatsDAddress != "" {
+		statsDAddress = envStatsDAddress
+	}
+	if envStatsDFlushInterval != "" {
+		statsDFlushInterval, _ = strconv.Atoi(envStatsDFlushInterval)
+	}
+	if statsDFlushInterval <= 0 {
+		statsDFlushInterval = defaultStatsDFlushInterval
+	}
 
 	cfg.Server = &config.Server{
 		Address: serverAddress,
 	}
+	cfg.GRPC = &config.GRPC{
+		Address: grpcAddress,
+	}
+	cfg.StatsD = &StatsD{
+		Address:       statsDAddress,
+		FlushInterval: time.Duration(statsDFlushInterval) * time.Second,
+	}
+	cfg.Storage = &Storage{
+		Engine:             storageEngine,
+		Path:               storagePath,
+		CheckpointInterval: time.Duration(checkpointInterval) * time.Second,
+	}
+	cfg.Buffer = &Buffer{
+		Size:          bufferSize,
+		FlushInterval: time.Duration(bufferFlushInterval) * time.Second,
+	}
 	cfg.StoreInterval = time.Duration(storeInterval) * time.Second
 	cfg.FilePath = filePath
+	cfg.Key = key
+	cfg.CryptoKey = cryptoKey
 	cfg.Restore = restore
+	cfg.BackupKeep = backupKeep
 	cfg.Postgres = &config.Postgres{
 		DatabaseDSN: databaseDSN,
 	}
@@ -0,0 +1,267 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+)
+
+// buffer accumulates the gauge and counter updates between two flushes:
+// a gauge keeps its last value and the deltas of a counter are summed.
+type buffer struct {
+	gauges   map[string]models.Metric
+	counters map[string]models.Metric
+	// drained is closed when a flush takes the pending updates, the
+	// writers waiting for room in a full buffer wait on it.
+	drained  chan struct{}
+	flushNow chan struct{}
+	size     int
+	interval time.Duration
+	mu       sync.Mutex
+	// flushMu is held for writing while a batch is on its way to the
+	// store, the reads hold it for reading to see either the batch in the
+	// buffer or its result in the store, never neither nor both.
+	flushMu sync.RWMutex
+}
+
+// WithBuffer makes the service acknowledge the gauge and counter updates
+// once they are buffered and write them to the store in batches, when size
+// series are pending or every interval. A write to a full buffer waits for
+// the next flush. Updates in the buffer are lost if the process crashes.
+func WithBuffer(size int, interval time.Duration) Option {
+	return func(s *Service) {
+		s.buf = &buffer{
+			gauges:   make(map[string]models.Metric),
+			counters: make(map[string]models.Metric),
+			drained:  make(chan struct{}),
+			flushNow: make(chan struct{}, 1),
+			size:     size,
+			interval: interval,
+		}
+	}
+}
+
+// add buffers the updates, waiting until ctx is done while the buffer is full.
+func (b *buffer) add(ctx context.Context, updates []models.Metric) error {
+	for {
+		b.mu.Lock()
+		if len(b.gauges)+len(b.counters) < b.size {
+			break
+		}
+		drained := b.drained
+		b.mu.Unlock()
+		b.requestFlush()
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "buffer is full")
+		}
+	}
+	defer b.mu.Unlock()
+
+	for _, update := range updates {
+		key := update.Key()
+		switch update.Type {
+		case models.Gauge:
+			b.gauges[key] = update
+		case models.Counter:
+			current, ok := b.counters[key]
+			if !ok {
+				b.counters[key] = update
+				continue
+			}
+			value, _ := current.Value.(int64)
+			delta, ok := update.Value.(int64)
+			if !ok {
+				return errors.New("expected int64 type")
+			}
+			current.Value = value + delta
+			b.counters[key] = current
+		}
+	}
+	if len(b.gauges)+len(b.counters) >= b.size {
+		b.requestFlush()
+	}
+
+	return nil
+}
+
+func (b *buffer) requestFlush() {
+	select {
+	case b.flushNow <- struct{}{}:
+	default:
+	}
+}
+
+// take empties the buffer and releases the writers waiting for room.
+func (b *buffer) take() (gauges, counters []models.Metric) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	gauges = make([]models.Metric, 0, len(b.gauges))
+	for _, m := range b.gauges {
+		gauges = append(gauges, m)
+	}
+	counters = make([]models.Metric, 0, len(b.counters))
+	for _, m := range b.counters {
+		counters = append(counters, m)
+	}
+	b.gauges = make(map[string]models.Metric)
+	b.counters = make(map[string]models.Metric)
+	close(b.drained)
+	b.drained = make(chan struct{})
+
+	return gauges, counters
+}
+
+// restore puts back a batch the store did not accept. A gauge updated in
+// the meantime keeps its newer value.
+func (b *buffer) restore(gauges, counters []models.Metric) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, m := range gauges {
+		if _, ok := b.gauges[m.Key()]; !ok {
+			b.gauges[m.Key()] = m
+		}
+	}
+	for _, m := range counters {
+		key := m.Key()
+		if current, ok := b.counters[key]; ok {
+			value, _ := current.Value.(int64)
+			delta, _ := m.Value.(int64)
+			m.Value = value + delta
+		}
+		b.counters[key] = m
+	}
+}
+
+// pending returns the buffered update of the series, the caller holds flushMu.
+func (b *buffer) pending(mType, key string) (models.Metric, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var m models.Metric
+	var ok bool
+	switch mType {
+	case models.Gauge:
+		m, ok = b.gauges[key]
+	case models.Counter:
+		m, ok = b.counters[key]
+	}
+	return m, ok
+}
+
+// overlay applies the buffered updates of mType to the metrics read from
+// the store, the caller holds flushMu.
+func (b *buffer) overlay(mType string, metrics map[string]models.Metric) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch mType {
+	case models.Gauge:
+		for key, m := range b.gauges {
+			metrics[key] = m
+		}
+	case models.Counter:
+		for key, m := range b.counters {
+			metrics[key] = addCounter(metrics[key], m)
+		}
+	}
+}
+
+// addCounter adds the buffered delta to the stored counter, stored is the
+// zero Metric if the store has no value yet.
+func addCounter(stored, delta models.Metric) models.Metric {
+	value, _ := stored.Value.(int64)
+	d, _ := delta.Value.(int64)
+	delta.Value = value + d
+	return delta
+}
+
+// Run flushes the buffer every interval or when it fills up, until ctx is
+// done. The pending updates are left for Flush.
+func (s *Service) Run(ctx context.Context) {
+	if s.buf == nil {
+		return
+	}
+	ticker := time.NewTicker(s.buf.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.buf.flushNow:
+		}
+		if err := s.Flush(ctx); err != nil {
+			zap.L().Error("service.Flush", zap.Error(err))
+		}
+	}
+}
+
+// Flush writes the buffered updates to the store. On failure they stay in
+// the buffer for the next flush.
+func (s *Service) Flush(ctx context.Context) error {
+	if s.buf == nil {
+		return nil
+	}
+	s.buf.flushMu.Lock()
+	defer s.buf.flushMu.Unlock()
+
+	gauges, counters := s.buf.take()
+	if len(counters) != 0 {
+		err := s.write(ctx, counters, func() error {
+			return s.store.PutCounterMetrics(ctx, counters)
+		})
+		if err != nil {
+			s.buf.restore(gauges, counters)
+			return errors.Wrap(err, "store.PutCounterMetrics")
+		}
+	}
+	if len(gauges) != 0 {
+		err := s.write(ctx, gauges, func() error {
+			return s.store.PutGaugeMetrics(ctx, gauges)
+		})
+		if err != nil {
+			s.buf.restore(gauges, nil)
+			return errors.Wrap(err, "store.PutGaugeMetrics")
+		}
+	}
+
+	return nil
+}
+
+// getBuffered reads a gauge or a counter together with its buffered update.
+func (s *Service) getBuffered(ctx context.Context, mType, name string, labels map[string]string) (models.Metric, error) {
+	s.buf.flushMu.RLock()
+	defer s.buf.flushMu.RUnlock()
+
+	var stored models.Metric
+	var err error
+	switch mType {
+	case models.Gauge:
+		stored, err = s.store.GetGaugeMetric(ctx, name, labels)
+	case models.Counter:
+		stored, err = s.store.GetCounterMetric(ctx, name, labels)
+	}
+	pending, ok := s.buf.pending(mType, models.SeriesKey(name, labels))
+	if !ok {
+		return stored, err
+	}
+	// the store has no value yet if it fails, every read error is
+	// reported as a missing metric anyway
+	if err != nil {
+		stored = models.Metric{}
+	}
+	if mType == models.Counter {
+		return addCounter(stored, pending), nil
+	}
+
+	return pending, nil
+}
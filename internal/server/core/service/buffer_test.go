@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VoevodinAnton/metrics/internal/pkg/domain"
+	"github.com/VoevodinAnton/metrics/internal/server/adapters/store/memory"
+)
+
+func counter(id string, delta int64) domain.Metrics {
+	return domain.Metrics{ID: id, MType: domain.Counter, Delta: &delta}
+}
+
+func gauge(id string, value float64) domain.Metrics {
+	return domain.Metrics{ID: id, MType: domain.Gauge, Value: &value}
+}
+
+func TestService_buffer(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStorage()
+	s := New(store, WithBuffer(10, time.Hour))
+
+	require.NoError(t, s.UpdatesMetrics(ctx, &[]domain.Metrics{counter("PollCount", 2), gauge("Alloc", 1)}))
+	require.NoError(t, s.Flush(ctx))
+	require.NoError(t, s.UpdatesMetrics(ctx, &[]domain.Metrics{
+		counter("PollCount", 3), counter("PollCount", 4), gauge("Alloc", 2), gauge("Alloc", 3),
+	}))
+
+	// the store has the first batch only, the reads see the buffered updates
+	stored, err := store.GetCounterMetric(ctx, "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stored.Value)
+
+	got, err := s.GetMetric(ctx, &domain.Metrics{ID: "PollCount", MType: domain.Counter})
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), *got.Delta)
+	got, err = s.GetMetric(ctx, &domain.Metrics{ID: "Alloc", MType: domain.Gauge})
+	require.NoError(t, err)
+	assert.Equal(t, float64(3), *got.Value)
+
+	all, err := s.GetMetrics(ctx)
+	require.NoError(t, err)
+	assert.Len(t, *all, 2)
+
+	require.NoError(t, s.Flush(ctx))
+	stored, err = store.GetCounterMetric(ctx, "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), stored.Value)
+}
+
+func TestService_bufferBackpressure(t *testing.T) {
+	ctx := context.Background()
+	s := New(memory.NewStorage(), WithBuffer(1, time.Hour))
+	require.NoError(t, s.UpdateMetric(ctx, &domain.Metrics{ID: "Alloc", MType: domain.Gauge, Value: new(float64)}))
+
+	// nothing flushes, the write gives up with its context
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	m := gauge("Sys", 1)
+	assert.ErrorIs(t, s.UpdateMetric(timeout, &m), context.DeadlineExceeded)
+
+	// a running flush loop makes room
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go s.Run(runCtx)
+	require.NoError(t, s.UpdateMetric(ctx, &m))
+	got, err := s.GetMetric(ctx, &domain.Metrics{ID: "Sys", MType: domain.Gauge})
+	require.NoError(t, err)
+	assert.Equal(t, float64(1), *got.Value)
+}
+
+func TestService_deleteBuffered(t *testing.T) {
+	ctx := context.Background()
+	s := New(memory.NewStorage(), WithBuffer(10, time.Hour))
+	require.NoError(t, s.UpdatesMetrics(ctx, &[]domain.Metrics{counter("PollCount", 2), gauge("Alloc", 1)}))
+
+	// the pending updates are deleted and reset as well as the stored ones
+	deleted, err := s.DeleteMetrics(ctx, &[]domain.Metrics{{ID: "Alloc", MType: domain.Gauge}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	_, err = s.GetMetric(ctx, &domain.Metrics{ID: "Alloc", MType: domain.Gauge})
+	assert.Error(t, err)
+
+	m := counter("PollCount", 3)
+	require.NoError(t, s.UpdateMetric(ctx, &m))
+	reset, err := s.ResetCounters(ctx, &[]domain.Metrics{{ID: "PollCount"}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, reset)
+	got, err := s.GetMetric(ctx, &domain.Metrics{ID: "PollCount", MType: domain.Counter})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), *got.Delta)
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VoevodinAnton/metrics/internal/pkg/domain"
+	"github.com/VoevodinAnton/metrics/internal/server/models"
+)
+
+// historyStore returns points for any history query and records the last one.
+type historyStore struct {
+	Store
+	query  models.HistoryQuery
+	points []models.HistoryPoint
+}
+
+func (s *historyStore) GetGaugeHistory(ctx context.Context, query models.HistoryQuery) ([]models.HistoryPoint, error) {
+	s.query = query
+	return s.points, nil
+}
+
+func (s *historyStore) GetCounterHistory(ctx context.Context, query models.HistoryQuery) ([]models.HistoryPoint, error) {
+	s.query = query
+	return s.points, nil
+}
+
+func TestService_GetMetricHistory(t *testing.T) {
+	t0 := time.Unix(1699999980, 0)
+	ptr := func(v float64) *float64 { return &v }
+	delta := func(v int64) *int64 { return &v }
+
+	tests := []struct {
+		name   string
+		req    domain.HistoryRequest
+		points []models.HistoryPoint
+		want   []domain.HistoryPoint
+	}{
+		{
+			name:   "raw gauge points",
+			req:    domain.HistoryRequest{ID: "Alloc", MType: domain.Gauge},
+			points: []models.HistoryPoint{{Time: t0, Value: 1.5}},
+			want:   []domain.HistoryPoint{{Time: t0, Value: ptr(1.5)}},
+		},
+		{
+			name:   "gauge buckets",
+			req:    domain.HistoryRequest{ID: "Alloc", MType: domain.Gauge, Step: time.Minute},
+			points: []models.HistoryPoint{{Time: t0, Avg: 2, Min: 1, Max: 4, Value: 3}},
+			want:   []domain.HistoryPoint{{Time: t0, Avg: ptr(2), Min: ptr(1), Max: ptr(4), Last: ptr(3)}},
+		},
+		{
+			name:   "raw counter points",
+			req:    domain.HistoryRequest{ID: "PollCount", MType: domain.Counter},
+			points: []models.HistoryPoint{{Time: t0, Delta: 5}},
+			want:   []domain.HistoryPoint{{Time: t0, Delta: delta(5)}},
+		},
+		{
+			name: "counter buckets with the rate per second",
+			req:  domain.HistoryRequest{ID: "PollCount", MType: domain.Counter, Step: time.Minute},
+			points: []models.HistoryPoint{
+				{Time: t0, Delta: 120},
+				{Time: t0.Add(time.Minute), Delta: 30},
+			},
+			want: []domain.HistoryPoint{
+				{Time: t0, Delta: delta(120), Rate: ptr(2)},
+				{Time: t0.Add(time.Minute), Delta: delta(30), Rate: ptr(0.5)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &historyStore{points: tt.points}
+			tt.req.From, tt.req.To = t0, t0.Add(time.Hour)
+			tt.req.Labels = map[string]string{"host": "a"}
+
+			got, err := New(store).GetMetricHistory(context.Background(), &tt.req)
+			require.NoError(t, err)
+			assert.Equal(t, models.HistoryQuery{
+				Name: tt.req.ID, Labels: tt.req.Labels, From: tt.req.From, To: tt.req.To, Step: tt.req.Step,
+			}, store.query)
+			assert.Equal(t, tt.want, got.Points)
+			if tt.req.Step != 0 {
+				assert.Equal(t, tt.req.Step.String(), got.Step)
+			}
+		})
+	}
+}
@@ -7,8 +7,9 @@ import (
 
 func requestToMetric(m *domain.Metrics) models.Metric {
 	metric := models.Metric{
-		Name: m.ID,
-		Type: m.MType,
+		Name:   m.ID,
+		Type:   m.MType,
+		Labels: m.Labels,
 	}
 
 	switch m.MType {
@@ -16,6 +17,17 @@ func requestToMetric(m *domain.Metrics) models.Metric {
 		metric.Value = *m.Value
 	case models.Counter:
 		metric.Value = *m.Delta
+	case models.Histogram:
+		var h models.HistogramValue
+		if m.Histogram != nil {
+			h = models.HistogramValue{
+				Buckets: m.Histogram.Buckets,
+				Counts:  m.Histogram.Counts,
+				Sum:     m.Histogram.Sum,
+				Count:   m.Histogram.Count,
+			}
+		}
+		metric.Value = h
 	}
 
 	return metric
@@ -29,10 +41,25 @@ func requestToMetrics(ms *[]domain.Metrics) []models.Metric {
 	return metrics
 }
 
+// requestToSeries keeps the series identity of the metrics, with mType
+// replacing their type if it is set.
+func requestToSeries(ms *[]domain.Metrics, mType string) []models.Metric {
+	series := make([]models.Metric, 0, len(*ms))
+	for _, m := range *ms {
+		metric := models.Metric{Name: m.ID, Type: m.MType, Labels: m.Labels}
+		if mType != "" {
+			metric.Type = mType
+		}
+		series = append(series, metric)
+	}
+	return series
+}
+
 func metricToResponse(m models.Metric) *domain.Metrics {
 	metric := &domain.Metrics{
-		ID:    m.Name,
-		MType: m.Type,
+		ID:     m.Name,
+		MType:  m.Type,
+		Labels: m.Labels,
 	}
 
 	switch m.Type {
@@ -42,7 +69,62 @@ func metricToResponse(m models.Metric) *domain.Metrics {
 	case domain.Gauge:
 		v, _ := m.Value.(float64)
 		metric.Value = &v
+	case domain.Histogram:
+		v, _ := m.Value.(models.HistogramValue)
+		metric.Histogram = &domain.HistogramValue{
+			Buckets: v.Buckets,
+			Counts:  v.Counts,
+			Sum:     v.Sum,
+			Count:   v.Count,
+		}
 	}
 
 	return metric
 }
+
+func historyRequestToQuery(req *domain.HistoryRequest) models.HistoryQuery {
+	return models.HistoryQuery{
+		Name:   req.ID,
+		Labels: req.Labels,
+		From:   req.From,
+		To:     req.To,
+		Step:   req.Step,
+	}
+}
+
+func historyToResponse(req *domain.HistoryRequest, points []models.HistoryPoint) *domain.History {
+	history := &domain.History{
+		ID:     req.ID,
+		MType:  req.MType,
+		Labels: req.Labels,
+		From:   req.From,
+		To:     req.To,
+		Points: make([]domain.HistoryPoint, 0, len(points)),
+	}
+	if req.Step != 0 {
+		history.Step = req.Step.String()
+	}
+
+	for _, p := range points {
+		p := p
+		point := domain.HistoryPoint{Time: p.Time}
+		switch {
+		case req.MType == domain.Gauge && req.Step == 0:
+			point.Value = &p.Value
+		case req.MType == domain.Gauge:
+			point.Avg = &p.Avg
+			point.Min = &p.Min
+			point.Max = &p.Max
+			point.Last = &p.Value
+		case req.MType == domain.Counter && req.Step == 0:
+			point.Delta = &p.Delta
+		case req.MType == domain.Counter:
+			rate := float64(p.Delta) / req.Step.Seconds()
+			point.Delta = &p.Delta
+			point.Rate = &rate
+		}
+		history.Points = append(history.Points, point)
+	}
+
+	return history
+}
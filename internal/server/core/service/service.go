@@ -9,26 +9,67 @@ import (
 )
 
 type Store interface {
-	GetCounterMetric(ctx context.Context, name string) (models.Metric, error)
-	GetGaugeMetric(ctx context.Context, name string) (models.Metric, error)
+	GetCounterMetric(ctx context.Context, name string, labels map[string]string) (models.Metric, error)
+	GetGaugeMetric(ctx context.Context, name string, labels map[string]string) (models.Metric, error)
+	GetHistogramMetric(ctx context.Context, name string, labels map[string]string) (models.Metric, error)
 	GetCounterMetrics(ctx context.Context) (map[string]models.Metric, error)
 	GetGaugeMetrics(ctx context.Context) (map[string]models.Metric, error)
+	GetHistogramMetrics(ctx context.Context) (map[string]models.Metric, error)
 	PutCounterMetric(ctx context.Context, metric models.Metric) error
 	PutGaugeMetric(ctx context.Context, metric models.Metric) error
+	PutHistogramMetric(ctx context.Context, metric models.Metric) error
 	PutCounterMetrics(ctx context.Context, updates []models.Metric) error
 	PutGaugeMetrics(ctx context.Context, updates []models.Metric) error
+	PutHistogramMetrics(ctx context.Context, updates []models.Metric) error
+	DeleteMetrics(ctx context.Context, metrics []models.Metric) (int, error)
+	ResetCounterMetrics(ctx context.Context, metrics []models.Metric) (int, error)
+	GetGaugeHistory(ctx context.Context, query models.HistoryQuery) ([]models.HistoryPoint, error)
+	GetCounterHistory(ctx context.Context, query models.HistoryQuery) ([]models.HistoryPoint, error)
 
 	Ping(ctx context.Context) error
 }
 
+// WAL persists the updates as they are applied. Write must call apply and
+// record the updates only if it succeeds, so do Delete and ResetCounters
+// with the series deleted and the counters reset.
+type WAL interface {
+	Write(ctx context.Context, updates []models.Metric, apply func() error) error
+	Delete(ctx context.Context, metrics []models.Metric, apply func() error) error
+	ResetCounters(ctx context.Context, metrics []models.Metric, apply func() error) error
+}
+
 type Service struct {
 	store Store
+	wal   WAL
+	buf   *buffer
+}
+
+type Option func(*Service)
+
+// WithWAL makes every successful update persisted by wal before it is
+// acknowledged.
+func WithWAL(wal WAL) Option {
+	return func(s *Service) {
+		s.wal = wal
+	}
 }
 
-func New(store Store) *Service {
-	return &Service{
+func New(store Store, opts ...Option) *Service {
+	s := &Service{
 		store: store,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// write applies the updates to the store through the WAL, if there is one.
+func (s *Service) write(ctx context.Context, updates []models.Metric, apply func() error) error {
+	if s.wal == nil {
+		return apply()
+	}
+	return s.wal.Write(ctx, updates, apply)
 }
 
 func (s *Service) GetMetric(ctx context.Context, metric *domain.Metrics) (*domain.Metrics, error) {
@@ -36,15 +77,28 @@ func (s *Service) GetMetric(ctx context.Context, metric *domain.Metrics) (*domai
 	var err error
 	switch metric.MType {
 	case models.Gauge:
-		metricResp, err = s.store.GetGaugeMetric(ctx, metric.ID)
+		if s.buf != nil {
+			metricResp, err = s.getBuffered(ctx, models.Gauge, metric.ID, metric.Labels)
+		} else {
+			metricResp, err = s.store.GetGaugeMetric(ctx, metric.ID, metric.Labels)
+		}
 		if err != nil {
 			return nil, errors.Wrap(err, "getGauge")
 		}
 	case models.Counter:
-		metricResp, err = s.store.GetCounterMetric(ctx, metric.ID)
+		if s.buf != nil {
+			metricResp, err = s.getBuffered(ctx, models.Counter, metric.ID, metric.Labels)
+		} else {
+			metricResp, err = s.store.GetCounterMetric(ctx, metric.ID, metric.Labels)
+		}
 		if err != nil {
 			return nil, errors.Wrap(err, "getCounter")
 		}
+	case models.Histogram:
+		metricResp, err = s.store.GetHistogramMetric(ctx, metric.ID, metric.Labels)
+		if err != nil {
+			return nil, errors.Wrap(err, "getHistogram")
+		}
 	}
 
 	return metricToResponse(metricResp), nil
@@ -52,17 +106,34 @@ func (s *Service) GetMetric(ctx context.Context, metric *domain.Metrics) (*domai
 
 func (s *Service) UpdateMetric(ctx context.Context, metric *domain.Metrics) error {
 	metricUpdate := requestToMetric(metric)
+	if s.buf != nil && (metric.MType == models.Gauge || metric.MType == models.Counter) {
+		return errors.Wrap(s.buf.add(ctx, []models.Metric{metricUpdate}), "buffer.add")
+	}
 	switch metric.MType {
 	case models.Gauge:
-		err := s.store.PutGaugeMetric(ctx, metricUpdate)
+		err := s.write(ctx, []models.Metric{metricUpdate}, func() error {
+			return s.store.PutGaugeMetric(ctx, metricUpdate)
+		})
 		if err != nil {
 			return errors.Wrap(err, "putGaugeMetric")
 		}
 	case models.Counter:
-		err := s.store.PutCounterMetric(ctx, metricUpdate)
+		err := s.write(ctx, []models.Metric{metricUpdate}, func() error {
+			return s.store.PutCounterMetric(ctx, metricUpdate)
+		})
 		if err != nil {
 			return errors.Wrap(err, "putCounterMetric")
 		}
+	case models.Histogram:
+		if err := metricUpdate.Value.(models.HistogramValue).Validate(); err != nil {
+			return errors.Wrap(err, metric.ID)
+		}
+		err := s.write(ctx, []models.Metric{metricUpdate}, func() error {
+			return s.store.PutHistogramMetric(ctx, metricUpdate)
+		})
+		if err != nil {
+			return errors.Wrap(err, "putHistogramMetric")
+		}
 	}
 	return nil
 }
@@ -71,29 +142,59 @@ func (s *Service) UpdatesMetrics(ctx context.Context, metrics *[]domain.Metrics)
 	metricsModel := requestToMetrics(metrics)
 	gaugeMetrics := make([]models.Metric, 0)
 	counterMetrics := make([]models.Metric, 0)
+	histogramMetrics := make([]models.Metric, 0)
 	for _, metric := range metricsModel {
 		switch metric.Type {
 		case models.Gauge:
 			gaugeMetrics = append(gaugeMetrics, metric)
 		case models.Counter:
 			counterMetrics = append(counterMetrics, metric)
+		case models.Histogram:
+			if err := metric.Value.(models.HistogramValue).Validate(); err != nil {
+				return errors.Wrap(err, metric.Name)
+			}
+			histogramMetrics = append(histogramMetrics, metric)
+		}
+	}
+	if s.buf != nil {
+		if err := s.buf.add(ctx, append(counterMetrics, gaugeMetrics...)); err != nil {
+			return errors.Wrap(err, "buffer.add")
 		}
+		counterMetrics, gaugeMetrics = nil, nil
 	}
 	if len(counterMetrics) != 0 {
-		if err := s.store.PutCounterMetrics(ctx, counterMetrics); err != nil {
+		err := s.write(ctx, counterMetrics, func() error {
+			return s.store.PutCounterMetrics(ctx, counterMetrics)
+		})
+		if err != nil {
 			return errors.Wrap(err, "store.PutCounterMetrics")
 		}
 	}
 	if len(gaugeMetrics) != 0 {
-		if err := s.store.PutGaugeMetrics(ctx, gaugeMetrics); err != nil {
+		err := s.write(ctx, gaugeMetrics, func() error {
+			return s.store.PutGaugeMetrics(ctx, gaugeMetrics)
+		})
+		if err != nil {
 			return errors.Wrap(err, "store.PutGaugeMetrics")
 		}
 	}
+	if len(histogramMetrics) != 0 {
+		err := s.write(ctx, histogramMetrics, func() error {
+			return s.store.PutHistogramMetrics(ctx, histogramMetrics)
+		})
+		if err != nil {
+			return errors.Wrap(err, "store.PutHistogramMetrics")
+		}
+	}
 
 	return nil
 }
 
 func (s *Service) GetMetrics(ctx context.Context) (*[]domain.Metrics, error) {
+	if s.buf != nil {
+		s.buf.flushMu.RLock()
+		defer s.buf.flushMu.RUnlock()
+	}
 	counterMetrics, err := s.store.GetCounterMetrics(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "getCounterMetrics")
@@ -102,17 +203,102 @@ func (s *Service) GetMetrics(ctx context.Context) (*[]domain.Metrics, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "getGaugeMetrics")
 	}
-	resp := make([]domain.Metrics, 0, len(counterMetrics)+len(gaugeMetrics))
+	histogramMetrics, err := s.store.GetHistogramMetrics(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "getHistogramMetrics")
+	}
+	if s.buf != nil {
+		s.buf.overlay(models.Counter, counterMetrics)
+		s.buf.overlay(models.Gauge, gaugeMetrics)
+	}
+	resp := make([]domain.Metrics, 0, len(counterMetrics)+len(gaugeMetrics)+len(histogramMetrics))
 	for _, v := range counterMetrics {
 		resp = append(resp, *metricToResponse(v))
 	}
 	for _, v := range gaugeMetrics {
 		resp = append(resp, *metricToResponse(v))
 	}
+	for _, v := range histogramMetrics {
+		resp = append(resp, *metricToResponse(v))
+	}
 
 	return &resp, nil
 }
 
+func (s *Service) GetMetricHistory(ctx context.Context, req *domain.HistoryRequest) (*domain.History, error) {
+	query := historyRequestToQuery(req)
+	var points []models.HistoryPoint
+	var err error
+	switch req.MType {
+	case models.Gauge:
+		points, err = s.store.GetGaugeHistory(ctx, query)
+		if err != nil {
+			return nil, errors.Wrap(err, "getGaugeHistory")
+		}
+	case models.Counter:
+		points, err = s.store.GetCounterHistory(ctx, query)
+		if err != nil {
+			return nil, errors.Wrap(err, "getCounterHistory")
+		}
+	}
+
+	return historyToResponse(req, points), nil
+}
+
+// DeleteMetrics removes the series of the metrics, only the id, the type and
+// the labels are used. It returns the number of series that existed.
+func (s *Service) DeleteMetrics(ctx context.Context, metrics *[]domain.Metrics) (int, error) {
+	// the buffered updates go to the store first, so that they are deleted too
+	if err := s.Flush(ctx); err != nil {
+		return 0, errors.Wrap(err, "flush")
+	}
+	series := requestToSeries(metrics, "")
+	var deleted int
+	apply := func() error {
+		var err error
+		deleted, err = s.store.DeleteMetrics(ctx, series)
+		return err
+	}
+	var err error
+	if s.wal == nil {
+		err = apply()
+	} else {
+		err = s.wal.Delete(ctx, series, apply)
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "store.DeleteMetrics")
+	}
+
+	return deleted, nil
+}
+
+// ResetCounters sets the counters of the metrics to zero, the type and the
+// delta are ignored. It returns the number of counters that existed.
+func (s *Service) ResetCounters(ctx context.Context, metrics *[]domain.Metrics) (int, error) {
+	// the buffered deltas go to the store first, so that they are reset too
+	if err := s.Flush(ctx); err != nil {
+		return 0, errors.Wrap(err, "flush")
+	}
+	series := requestToSeries(metrics, models.Counter)
+	var reset int
+	apply := func() error {
+		var err error
+		reset, err = s.store.ResetCounterMetrics(ctx, series)
+		return err
+	}
+	var err error
+	if s.wal == nil {
+		err = apply()
+	} else {
+		err = s.wal.ResetCounters(ctx, series, apply)
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "store.ResetCounterMetrics")
+	}
+
+	return reset, nil
+}
+
 func (s *Service) Ping(ctx context.Context) error {
 	return errors.Wrap(s.store.Ping(ctx), "ping")
 }
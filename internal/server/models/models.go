@@ -1,12 +1,166 @@
 package models
 
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
 const (
-	Gauge   string = "gauge"
-	Counter string = "counter"
+	Gauge     string = "gauge"
+	Counter   string = "counter"
+	Histogram string = "histogram"
+)
+
+var (
+	// ErrMetricNotFound is returned by every store for a missing series.
+	ErrMetricNotFound          = errors.New("metric not found")
+	ErrHistoryNotSupported     = errors.New("history is not supported by the store")
+	ErrInvalidHistogram        = errors.New("invalid histogram")
+	ErrHistogramBucketMismatch = errors.New("histogram bucket boundaries mismatch")
 )
 
 type Metric struct {
-	Value any
-	Name  string
-	Type  string
+	Value  any
+	Labels map[string]string
+	Name   string
+	Type   string
+}
+
+// Key returns the series identity of the metric.
+func (m Metric) Key() string {
+	return SeriesKey(m.Name, m.Labels)
+}
+
+// SeriesKey builds the series identity from the metric name and its labels,
+// e.g. Alloc{hostname="a",instance="b"}. A metric without labels is identified
+// by its name only.
+func SeriesKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[k]))
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+// HistogramValue is the value of a histogram metric. Buckets are the
+// ascending upper bounds, Counts holds the number of observations in every
+// bucket plus the last one above the highest bound, so it is one longer.
+type HistogramValue struct {
+	Buckets []float64
+	Counts  []uint64
+	Sum     float64
+	Count   uint64
+}
+
+// Validate checks that the bounds are ascending and the counts add up.
+func (h HistogramValue) Validate() error {
+	if len(h.Counts) != len(h.Buckets)+1 {
+		return errors.Wrap(ErrInvalidHistogram, "counts must be one more than buckets")
+	}
+	for i := 1; i < len(h.Buckets); i++ {
+		if h.Buckets[i] <= h.Buckets[i-1] {
+			return errors.Wrap(ErrInvalidHistogram, "buckets must be ascending")
+		}
+	}
+	var count uint64
+	for _, c := range h.Counts {
+		count += c
+	}
+	if count != h.Count {
+		return errors.Wrap(ErrInvalidHistogram, "count must be the sum of counts")
+	}
+
+	return nil
+}
+
+// Merge adds the observations of update to the histogram. Both must have
+// the same bucket boundaries.
+func (h HistogramValue) Merge(update HistogramValue) (HistogramValue, error) {
+	if len(h.Buckets) != len(update.Buckets) {
+		return HistogramValue{}, ErrHistogramBucketMismatch
+	}
+	for i := range h.Buckets {
+		if h.Buckets[i] != update.Buckets[i] {
+			return HistogramValue{}, ErrHistogramBucketMismatch
+		}
+	}
+
+	merged := HistogramValue{
+		Buckets: h.Buckets,
+		Counts:  make([]uint64, len(h.Counts)),
+		Sum:     h.Sum + update.Sum,
+		Count:   h.Count + update.Count,
+	}
+	for i := range h.Counts {
+		merged.Counts[i] = h.Counts[i] + update.Counts[i]
+	}
+
+	return merged, nil
+}
+
+// HistoryQuery selects the writes of a single series within [From, To).
+// A zero Step requests raw points, otherwise points are aggregated into
+// Step-aligned buckets. Writes that were already compacted by the retention
+// job are returned at the resolution they are kept in.
+type HistoryQuery struct {
+	From   time.Time
+	To     time.Time
+	Labels map[string]string
+	Name   string
+	Step   time.Duration
+}
+
+// HistoryPoint is either a single raw write or a bucket of writes.
+// For gauges Value holds the written value, or the last value of a bucket;
+// for counters Delta holds the written delta, or the sum of bucket deltas.
+type HistoryPoint struct {
+	Time  time.Time
+	Value float64
+	Avg   float64
+	Min   float64
+	Max   float64
+	Delta int64
+}
+
+// RetentionPolicy defines how long the data of every resolution is kept.
+// Raw writes older than Raw are rolled up into per-minute buckets, per-minute
+// buckets older than Minute are rolled up into per-hour buckets, and per-hour
+// buckets older than Hour are dropped. Counter deltas are never lost: the
+// dropped per-hour buckets are folded into a running total.
+type RetentionPolicy struct {
+	Raw    time.Duration
+	Minute time.Duration
+	Hour   time.Duration
+}
+
+type CompactionStats struct {
+	GaugeRawRows      int64
+	CounterRawRows    int64
+	GaugeMinuteRows   int64
+	CounterMinuteRows int64
+	GaugeHourRows     int64
+	CounterHourRows   int64
 }
@@ -0,0 +1,330 @@
+// Package client pushes application metrics to the metrics server.
+//
+// Counters and gauges are aggregated locally and sent in batches to the
+// /updates endpoint on every flush interval, in the same gzip compressed
+// JSON format the agent uses:
+//
+//	c := client.New("localhost:8080", client.WithLabels(map[string]string{"service": "billing"}))
+//	defer c.Close()
+//	c.Counter("PaymentsProcessed").Inc()
+//	c.Gauge("QueueLength").Set(42)
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/VoevodinAnton/metrics/internal/pkg/constants"
+	"github.com/VoevodinAnton/metrics/internal/pkg/domain"
+	"github.com/VoevodinAnton/metrics/pkg/encryption"
+	"github.com/VoevodinAnton/metrics/pkg/hash"
+	"github.com/VoevodinAnton/metrics/pkg/retry"
+)
+
+const (
+	updatesURLTemplate   = "http://%s/updates"
+	defaultFlushInterval = 10 * time.Second
+	defaultTimeout       = 10 * time.Second
+)
+
+// StatusError is returned by Flush if the server responds with a status other than 200.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d %s", e.Code, http.StatusText(e.Code))
+}
+
+func (e *StatusError) StatusCode() int {
+	return e.Code
+}
+
+type Option func(*Client)
+
+// WithLabels attaches the labels to every metric sent by the client.
+func WithLabels(labels map[string]string) Option {
+	return func(c *Client) {
+		c.labels = labels
+	}
+}
+
+// WithFlushInterval sets how often the pending metrics are sent.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(c *Client) {
+		c.flushInterval = interval
+	}
+}
+
+// WithKey signs the requests with HMAC-SHA256 of the key.
+func WithKey(key string) Option {
+	return func(c *Client) {
+		c.key = key
+	}
+}
+
+// WithPublicKey encrypts the request bodies with the server key.
+func WithPublicKey(key *rsa.PublicKey) Option {
+	return func(c *Client) {
+		c.publicKey = key
+	}
+}
+
+// WithHTTPClient replaces the default HTTP client with a 10 second timeout.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetrier replaces the retry policy of a failed flush.
+func WithRetrier(retrier *retry.Retrier) Option {
+	return func(c *Client) {
+		c.retrier = retrier
+	}
+}
+
+// Client aggregates the metrics of an application and sends them to the
+// server periodically. It is safe for concurrent use.
+type Client struct {
+	counters      map[string]*Counter
+	gauges        map[string]*Gauge
+	labels        map[string]string
+	httpClient    *http.Client
+	publicKey     *rsa.PublicKey
+	retrier       *retry.Retrier
+	stop          chan struct{}
+	done          chan struct{}
+	url           string
+	key           string
+	flushInterval time.Duration
+	// flushMu makes the flushes sequential, so that a failed batch is
+	// returned to the handles before the next one is taken.
+	flushMu   sync.Mutex
+	closeOnce sync.Once
+	mu        sync.Mutex
+}
+
+// New creates a client sending metrics to the server at address
+// and starts the periodic flush.
+func New(address string, opts ...Option) *Client {
+	c := &Client{
+		url:           fmt.Sprintf(updatesURLTemplate, address),
+		counters:      make(map[string]*Counter),
+		gauges:        make(map[string]*Gauge),
+		httpClient:    &http.Client{Timeout: defaultTimeout},
+		retrier:       retry.New(),
+		flushInterval: defaultFlushInterval,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	go c.run()
+
+	return c
+}
+
+// Counter returns the counter handle for name, creating it on first use.
+func (c *Client) Counter(name string) *Counter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counter, ok := c.counters[name]
+	if !ok {
+		counter = &Counter{}
+		c.counters[name] = counter
+	}
+	return counter
+}
+
+// Gauge returns the gauge handle for name, creating it on first use.
+func (c *Client) Gauge(name string) *Gauge {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	gauge, ok := c.gauges[name]
+	if !ok {
+		gauge = &Gauge{}
+		c.gauges[name] = gauge
+	}
+	return gauge
+}
+
+func (c *Client) run() {
+	defer close(c.done)
+	ticker := time.NewTicker(c.flushInterval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-c.stop
+		cancel()
+	}()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			if err := c.Flush(ctx); err != nil {
+				zap.L().Error("client.Flush", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Flush sends the counter increments and the gauges changed since the last
+// flush. If sending fails they are kept for the next flush, unless the server
+// rejects them with a 4xx status: a batch it cannot accept is dropped.
+func (c *Client) Flush(ctx context.Context) error {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	batch := c.takeBatch()
+	if len(batch) == 0 {
+		return nil
+	}
+	body, err := c.encode(batch)
+	if err != nil {
+		c.restoreBatch(batch)
+		return err
+	}
+	err = c.retrier.Do(ctx, func() error {
+		return c.send(ctx, body)
+	})
+	if err != nil {
+		if isRejected(err) {
+			zap.L().Error("the server rejected the batch, dropping it", zap.Int("metrics", len(batch)), zap.Error(err))
+			return err
+		}
+		c.restoreBatch(batch)
+		return err
+	}
+
+	return nil
+}
+
+// Close stops the periodic flush and sends the pending metrics.
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		<-c.done
+		err = c.Flush(context.Background())
+	})
+	return err
+}
+
+func (c *Client) takeBatch() []domain.Metrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	batch := make([]domain.Metrics, 0, len(c.counters)+len(c.gauges))
+	for name, counter := range c.counters {
+		delta := counter.take()
+		if delta == 0 {
+			continue
+		}
+		batch = append(batch, domain.Metrics{ID: name, MType: domain.Counter, Delta: &delta, Labels: c.labels})
+	}
+	for name, gauge := range c.gauges {
+		value, ok := gauge.take()
+		if !ok {
+			continue
+		}
+		batch = append(batch, domain.Metrics{ID: name, MType: domain.Gauge, Value: &value, Labels: c.labels})
+	}
+
+	return batch
+}
+
+func (c *Client) restoreBatch(batch []domain.Metrics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, m := range batch {
+		switch m.MType {
+		case domain.Counter:
+			c.counters[m.ID].Add(*m.Delta)
+		case domain.Gauge:
+			c.gauges[m.ID].restore(*m.Value)
+		}
+	}
+}
+
+func (c *Client) encode(batch []domain.Metrics) ([]byte, error) {
+	metricsJSON, err := json.Marshal(batch)
+	if err != nil {
+		return nil, errors.Wrap(err, "json.Marshal")
+	}
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err = w.Write(metricsJSON); err != nil {
+		return nil, errors.Wrap(err, "writer.Write")
+	}
+	if err = w.Close(); err != nil {
+		return nil, errors.Wrap(err, "writer.Close")
+	}
+	body := b.Bytes()
+	if c.publicKey != nil {
+		body, err = encryption.Encrypt(c.publicKey, body)
+		if err != nil {
+			return nil, errors.Wrap(err, "encryption.Encrypt")
+		}
+	}
+
+	return body, nil
+}
+
+func (c *Client) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "http.NewRequestWithContext")
+	}
+	req.Header.Set(constants.ContentTypeHeader, constants.ContentTypeJSON)
+	req.Header.Set(constants.ContentEncodingHeader, constants.GzipEncoding)
+	if c.publicKey != nil {
+		req.Header.Set(constants.EncryptionHeader, constants.EncryptionRSAAESGCM)
+	}
+	if c.key != "" {
+		req.Header.Set(constants.HashSHA256Header, hash.Sign([]byte(c.key), body))
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "httpClient.Do")
+	}
+	if err = resp.Body.Close(); err != nil {
+		return errors.Wrap(err, "body.Close")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{Code: resp.StatusCode}
+	}
+
+	return nil
+}
+
+// isRejected reports whether the server refused the batch itself, so sending
+// it again would fail the same way. A timeout and a rate limit are transient.
+func isRejected(err error) bool {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	switch statusErr.Code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return statusErr.Code >= http.StatusBadRequest && statusErr.Code < http.StatusInternalServerError
+}
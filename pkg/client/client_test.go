@@ -0,0 +1,185 @@
+package client
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/VoevodinAnton/metrics/internal/pkg/constants"
+	"github.com/VoevodinAnton/metrics/internal/pkg/domain"
+	"github.com/VoevodinAnton/metrics/pkg/hash"
+	"github.com/VoevodinAnton/metrics/pkg/retry"
+)
+
+type testServer struct {
+	*httptest.Server
+	batches [][]domain.Metrics
+	status  int
+	mu      sync.Mutex
+}
+
+func newTestServer(t *testing.T, key string) *testServer {
+	t.Helper()
+	s := &testServer{status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/updates", r.URL.Path)
+		assert.Equal(t, constants.GzipEncoding, r.Header.Get(constants.ContentEncodingHeader))
+		if key != "" {
+			assert.NotEmpty(t, r.Header.Get(constants.HashSHA256Header))
+		}
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		var batch []domain.Metrics
+		require.NoError(t, json.NewDecoder(gz).Decode(&batch))
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.status == http.StatusOK {
+			s.batches = append(s.batches, batch)
+		}
+		w.WriteHeader(s.status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testServer) setStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+func (s *testServer) received() map[string]domain.Metrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	metrics := make(map[string]domain.Metrics)
+	for _, batch := range s.batches {
+		for _, m := range batch {
+			metrics[m.MType+"/"+m.ID] = m
+		}
+	}
+	return metrics
+}
+
+func TestClient_Flush(t *testing.T) {
+	srv := newTestServer(t, "secret")
+	c := New(strings.TrimPrefix(srv.URL, "http://"),
+		WithFlushInterval(time.Hour),
+		WithKey("secret"),
+		WithLabels(map[string]string{"service": "test"}),
+		WithRetrier(retry.New(retry.WithBackoff())))
+	defer func() {
+		_ = c.Close()
+	}()
+
+	c.Counter("Requests").Inc()
+	c.Counter("Requests").Add(2)
+	c.Gauge("Queue").Set(5)
+	c.Gauge("Queue").Add(1)
+	c.Gauge("Idle").Set(1)
+	require.NoError(t, c.Flush(context.Background()))
+
+	received := srv.received()
+	require.Len(t, received, 3)
+	assert.Equal(t, int64(3), *received["counter/Requests"].Delta)
+	assert.Equal(t, float64(6), *received["gauge/Queue"].Value)
+	assert.Equal(t, map[string]string{"service": "test"}, received["gauge/Queue"].Labels)
+
+	// a failed flush keeps the increments for the next one
+	srv.setStatus(http.StatusInternalServerError)
+	c.Counter("Requests").Add(4)
+	c.Gauge("Queue").Set(7)
+	var statusErr *StatusError
+	require.ErrorAs(t, c.Flush(context.Background()), &statusErr)
+
+	srv.setStatus(http.StatusOK)
+	c.Counter("Requests").Inc()
+	require.NoError(t, c.Close())
+
+	received = srv.received()
+	assert.Equal(t, int64(5), *received["counter/Requests"].Delta)
+	assert.Equal(t, float64(7), *received["gauge/Queue"].Value)
+	assert.Len(t, srv.batches, 2)
+}
+
+func TestClient_FlushRejected(t *testing.T) {
+	srv := newTestServer(t, "")
+	c := New(strings.TrimPrefix(srv.URL, "http://"),
+		WithFlushInterval(time.Hour),
+		WithRetrier(retry.New(retry.WithBackoff())))
+	defer func() {
+		_ = c.Close()
+	}()
+
+	// a rejected batch is not sent again
+	srv.setStatus(http.StatusBadRequest)
+	c.Counter("Requests").Add(3)
+	c.Gauge("Queue").Set(5)
+	var statusErr *StatusError
+	require.ErrorAs(t, c.Flush(context.Background()), &statusErr)
+	assert.Equal(t, http.StatusBadRequest, statusErr.Code)
+
+	srv.setStatus(http.StatusOK)
+	c.Counter("Requests").Inc()
+	require.NoError(t, c.Flush(context.Background()))
+
+	received := srv.received()
+	require.Len(t, received, 1)
+	assert.Equal(t, int64(1), *received["counter/Requests"].Delta)
+}
+
+func TestClient_FlushContext(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+	c := New(strings.TrimPrefix(srv.URL, "http://"),
+		WithFlushInterval(time.Hour),
+		WithRetrier(retry.New(retry.WithBackoff())))
+
+	c.Counter("Requests").Inc()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, c.Flush(ctx), context.DeadlineExceeded, "the in-flight request is cancelled")
+}
+
+func TestClient_FlushInterval(t *testing.T) {
+	srv := newTestServer(t, "")
+	c := New(strings.TrimPrefix(srv.URL, "http://"), WithFlushInterval(10*time.Millisecond))
+	defer func() {
+		_ = c.Close()
+	}()
+
+	c.Counter("Requests").Inc()
+	assert.Eventually(t, func() bool {
+		_, ok := srv.received()["counter/Requests"]
+		return ok
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestClient_Signature(t *testing.T) {
+	var signature string
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(constants.HashSHA256Header)
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	c := New(strings.TrimPrefix(srv.URL, "http://"), WithFlushInterval(time.Hour), WithKey("secret"))
+	c.Gauge("Queue").Set(1)
+	require.NoError(t, c.Close())
+	assert.True(t, hash.Verify([]byte("secret"), body, signature))
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Counter accumulates the increments until the next flush.
+type Counter struct {
+	delta atomic.Int64
+}
+
+func (c *Counter) Inc() {
+	c.delta.Add(1)
+}
+
+func (c *Counter) Add(delta int64) {
+	c.delta.Add(delta)
+}
+
+func (c *Counter) take() int64 {
+	return c.delta.Swap(0)
+}
+
+// Gauge keeps the last value set; it is sent only if it was set since
+// the last flush.
+type Gauge struct {
+	value float64
+	dirty bool
+	mu    sync.Mutex
+}
+
+func (g *Gauge) Set(value float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value = value
+	g.dirty = true
+}
+
+func (g *Gauge) Add(delta float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value += delta
+	g.dirty = true
+}
+
+func (g *Gauge) take() (float64, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	dirty := g.dirty
+	g.dirty = false
+	return g.value, dirty
+}
+
+// restore marks the value of a failed flush for sending again,
+// unless the gauge was set after it.
+func (g *Gauge) restore(value float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.dirty {
+		g.value = value
+		g.dirty = true
+	}
+}
@@ -13,3 +13,7 @@ type Postgres struct {
 type Server struct {
 	Address string
 }
+
+type GRPC struct {
+	Address string
+}
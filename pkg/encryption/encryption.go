@@ -0,0 +1,155 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	sessionKeySize = 32
+	keyLenSize     = 2
+)
+
+var (
+	ErrInvalidPEM        = errors.New("invalid PEM block")
+	ErrInvalidKeyType    = errors.New("key is not an RSA key")
+	ErrInvalidCiphertext = errors.New("invalid ciphertext")
+)
+
+// Encrypt encrypts data with a random AES-256-GCM session key and encrypts
+// the session key with RSA-OAEP, so that batches of any size can be sent.
+// The result is laid out as: key length (2 bytes, big endian) | encrypted
+// session key | GCM nonce | sealed data.
+func Encrypt(key *rsa.PublicKey, data []byte) ([]byte, error) {
+	sessionKey := make([]byte, sessionKeySize)
+	if _, err := rand.Read(sessionKey); err != nil {
+		return nil, errors.Wrap(err, "rand.Read")
+	}
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, key, sessionKey, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "rsa.EncryptOAEP")
+	}
+	gcm, err := newGCM(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "rand.Read")
+	}
+
+	out := make([]byte, keyLenSize, keyLenSize+len(encryptedKey)+len(nonce)+len(data)+gcm.Overhead())
+	binary.BigEndian.PutUint16(out, uint16(len(encryptedKey)))
+	out = append(out, encryptedKey...)
+	out = append(out, nonce...)
+
+	return gcm.Seal(out, nonce, data, nil), nil
+}
+
+// Decrypt reverses Encrypt.
+func Decrypt(key *rsa.PrivateKey, data []byte) ([]byte, error) {
+	if len(data) < keyLenSize {
+		return nil, ErrInvalidCiphertext
+	}
+	keyLen := int(binary.BigEndian.Uint16(data))
+	data = data[keyLenSize:]
+	if len(data) < keyLen {
+		return nil, ErrInvalidCiphertext
+	}
+	sessionKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, key, data[:keyLen], nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "rsa.DecryptOAEP")
+	}
+	data = data[keyLen:]
+
+	gcm, err := newGCM(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "gcm.Open")
+	}
+
+	return plain, nil
+}
+
+// LoadPublicKey reads a PEM encoded PKIX or PKCS #1 RSA public key.
+func LoadPublicKey(path string) (*rsa.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "x509.ParsePKIXPublicKey")
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, ErrInvalidKeyType
+	}
+
+	return rsaKey, nil
+}
+
+// LoadPrivateKey reads a PEM encoded PKCS #1 or PKCS #8 RSA private key.
+func LoadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "x509.ParsePKCS8PrivateKey")
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidKeyType
+	}
+
+	return rsaKey, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "os.ReadFile")
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+
+	return block, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "aes.NewCipher")
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "cipher.NewGCM")
+	}
+
+	return gcm, nil
+}
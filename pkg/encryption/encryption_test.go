@@ -0,0 +1,63 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	privatePath := filepath.Join(dir, "private.pem")
+	publicPath := filepath.Join(dir, "public.pem")
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{
+		Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}), 0600))
+	require.NoError(t, os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{
+		Type: "PUBLIC KEY", Bytes: publicDER,
+	}), 0600))
+
+	publicKey, err := LoadPublicKey(publicPath)
+	require.NoError(t, err)
+	privateKey, err := LoadPrivateKey(privatePath)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: []byte{}},
+		{name: "small", data: []byte(`[{"id":"Alloc","type":"gauge","value":1}]`)},
+		{name: "larger than rsa block", data: bytes.Repeat([]byte("metrics"), 100000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encrypted, err := Encrypt(publicKey, tt.data)
+			require.NoError(t, err)
+
+			decrypted, err := Decrypt(privateKey, encrypted)
+			require.NoError(t, err)
+			assert.True(t, bytes.Equal(tt.data, decrypted))
+
+			encrypted[len(encrypted)-1] ^= 0xff
+			_, err = Decrypt(privateKey, encrypted)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err = Decrypt(privateKey, []byte{0xff})
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+}
@@ -0,0 +1,115 @@
+package retry
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultBackoff is the delay before every retry: four attempts in total.
+var DefaultBackoff = []time.Duration{1 * time.Second, 3 * time.Second, 5 * time.Second}
+
+// StatusCoder is implemented by errors that carry an HTTP status code.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+type Option func(*Retrier)
+
+// Retrier calls a function again after a delay while it fails with
+// a retriable error. The number of attempts is len(backoff) + 1.
+type Retrier struct {
+	isRetriable func(err error) bool
+	backoff     []time.Duration
+}
+
+func New(opts ...Option) *Retrier {
+	r := &Retrier{
+		backoff:     DefaultBackoff,
+		isRetriable: IsRetriable,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// WithBackoff sets the delays between attempts.
+func WithBackoff(backoff ...time.Duration) Option {
+	return func(r *Retrier) {
+		r.backoff = backoff
+	}
+}
+
+// WithClassifier replaces IsRetriable as the check whether an error is worth retrying.
+func WithClassifier(isRetriable func(err error) bool) Option {
+	return func(r *Retrier) {
+		r.isRetriable = isRetriable
+	}
+}
+
+// Do calls fn until it succeeds, fails with a non-retriable error or the
+// attempts are exhausted, and returns the last error. The waiting between
+// attempts stops as soon as ctx is done.
+func (r *Retrier) Do(ctx context.Context, fn func() error) error {
+	err := fn()
+	for _, delay := range r.backoff {
+		if err == nil || !r.isRetriable(err) {
+			return err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		err = fn()
+	}
+
+	return err
+}
+
+// IsRetriable reports whether err is a transient failure: a network error,
+// a postgres connection exception, an HTTP 502, 503 or 504 response or
+// an unavailable gRPC server.
+func IsRetriable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgerrcode.IsConnectionException(pgErr.Code) || pgErr.Code == pgerrcode.CannotConnectNow
+	}
+	if pgconn.SafeToRetry(err) {
+		return true
+	}
+
+	var statusErr StatusCoder
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode() {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	if s, ok := status.FromError(err); ok {
+		return s.Code() == codes.Unavailable
+	}
+
+	return false
+}
@@ -0,0 +1,98 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type statusError int
+
+func (e statusError) Error() string {
+	return http.StatusText(int(e))
+}
+
+func (e statusError) StatusCode() int {
+	return int(e)
+}
+
+func TestIsRetriable(t *testing.T) {
+	tests := []struct {
+		err  error
+		name string
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "net error", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, want: true},
+		{name: "pg connection exception", err: &pgconn.PgError{Code: pgerrcode.ConnectionFailure}, want: true},
+		{name: "pg unique violation", err: &pgconn.PgError{Code: pgerrcode.UniqueViolation}, want: false},
+		{name: "service unavailable", err: statusError(http.StatusServiceUnavailable), want: true},
+		{name: "internal server error", err: statusError(http.StatusInternalServerError), want: false},
+		{name: "grpc unavailable", err: status.Error(codes.Unavailable, "down"), want: true},
+		{name: "grpc invalid argument", err: status.Error(codes.InvalidArgument, "bad"), want: false},
+		{name: "plain error", err: errors.New("plain"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsRetriable(tt.err))
+		})
+	}
+}
+
+func TestRetrier_Do(t *testing.T) {
+	errRetriable := statusError(http.StatusServiceUnavailable)
+	errFatal := errors.New("fatal")
+
+	tests := []struct {
+		wantErr   error
+		name      string
+		errs      []error
+		wantCalls int
+	}{
+		{name: "success", errs: []error{nil}, wantCalls: 1},
+		{name: "retriable then success", errs: []error{errRetriable, errRetriable, nil}, wantCalls: 3},
+		{name: "non-retriable", errs: []error{errFatal}, wantCalls: 1, wantErr: errFatal},
+		{
+			name:      "attempts exhausted",
+			errs:      []error{errRetriable, errRetriable, errRetriable, errRetriable},
+			wantCalls: 4,
+			wantErr:   errRetriable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New(WithBackoff(time.Millisecond, time.Millisecond, time.Millisecond))
+			calls := 0
+			err := r.Do(context.Background(), func() error {
+				calls++
+				return tt.errs[calls-1]
+			})
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantCalls, calls)
+		})
+	}
+}
+
+func TestRetrier_DoCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r := New(WithBackoff(time.Hour))
+	calls := 0
+	err := r.Do(ctx, func() error {
+		calls++
+		return statusError(http.StatusServiceUnavailable)
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+}